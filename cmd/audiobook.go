@@ -6,27 +6,45 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/deegital/elevencli/internal/atomicfile"
 	"github.com/deegital/elevencli/internal/audio"
 	"github.com/deegital/elevencli/internal/audiobook"
 )
 
 var (
-	audiobookOutput     string
-	audiobookKeepBlocks bool
-	audiobookStdin      bool
-	audiobookStdout     bool
+	audiobookOutput      string
+	audiobookFormat      string
+	audiobookKeepBlocks  bool
+	audiobookStdin       bool
+	audiobookStdout      bool
+	audiobookConcurrency int
+	audiobookNoCache     bool
+	audiobookCacheDir    string
+	audiobookCachePrune  time.Duration
+	audiobookWorkDir     string
+	audiobookResume      bool
+	audiobookDryRun      bool
+	audiobookQuotaCheck  string
+	audiobookAPIFormat   string
+	audiobookSampleRate  int
+	audiobookChannels    int
+	audiobookCeiling     float64
+	audiobookDither      bool
 )
 
 var audiobookCmd = &cobra.Command{
 	Use:   "audiobook [script.json]",
 	Short: "Generate an audiobook from a JSON script",
 	Long: `Generate an audiobook by processing a JSON script that defines a sequence
-of TTS narration, sound effects, and silence blocks. The blocks are rendered
-via the ElevenLabs API and merged into a single MP3 file.`,
-	Args: cobra.RangeArgs(0, 1),
+of TTS narration, sound effects, local audio files, and silence blocks. The
+blocks are rendered via the ElevenLabs API or read from disk and merged into a
+single MP3, WAV or FLAC file.`,
+	Args:        cobra.RangeArgs(0, 1),
+	Annotations: map[string]string{"noAuthFlag": "dry-run"},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if err := validateStdinArgs(cmd, args, audiobookStdin, audiobookStdout); err != nil {
 			return err
@@ -50,26 +68,155 @@ via the ElevenLabs API and merged into a single MP3 file.`,
 		if err := json.Unmarshal(data, &script); err != nil {
 			return fmt.Errorf("failed to parse script: %w", err)
 		}
+		if !audiobookStdin {
+			// File blocks are relative to the script, not the working directory.
+			script.Dir = filepath.Dir(args[0])
+		}
 
 		if err := script.Validate(); err != nil {
 			return fmt.Errorf("invalid script: %w", err)
 		}
 
-		key, err := resolveAPIKeyValue()
+		if audiobookConcurrency < 1 {
+			return fmt.Errorf("--concurrency must be at least 1")
+		}
+
+		switch audiobookQuotaCheck {
+		case "warn", "abort", "off":
+		default:
+			return fmt.Errorf("--quota-check must be one of: warn, abort, off")
+		}
+		if err := validateLoudnessFlags(cmd); err != nil {
+			return err
+		}
+		apiFormat, err := audio.ParseFormat(audiobookAPIFormat)
+		if err != nil {
+			return fmt.Errorf("invalid --api-format: %w", err)
+		}
+		sampleRate := audiobookSampleRate
+		if sampleRate == 0 {
+			sampleRate = apiFormat.SampleRate
+		}
+		if audiobookChannels < 0 || audiobookChannels > 2 {
+			return fmt.Errorf("--channels must be 1 or 2")
+		}
+		if audiobookCeiling < -20 || audiobookCeiling > 0 {
+			return fmt.Errorf("--ceiling must be between -20 and 0 dBFS, got %g", audiobookCeiling)
+		}
+		format := outputFormat(cmd, audiobookFormat, audiobookOutput)
+		switch format {
+		case "mp3", "wav", "flac":
+		default:
+			return fmt.Errorf("--format must be one of: mp3, wav, flac")
+		}
+		if err := validateBitrate(cmd, format); err != nil {
+			return err
+		}
+		if err := validateMode(cmd, format); err != nil {
+			return err
+		}
+		channels := audiobookChannels
+		if channels == 0 {
+			channels = 1
+			if script.Panned() {
+				channels = 2
+			}
+		}
+		if format == "mp3" {
+			if err := audio.CheckMP3(sampleRate, channels, mp3Bitrate, mp3Mode); err != nil {
+				return fmt.Errorf("cannot encode MP3: %w; change --sample-rate, --bitrate or --mode", err)
+			}
+		}
+
+		cacheDir := audiobookCacheDir
+		if cacheDir == "" && !audiobookNoCache {
+			cacheDir, err = audiobook.DefaultCacheDir()
+			if err != nil {
+				return err
+			}
+		}
+		workPath := audiobookWorkDir
+		if workPath == "" {
+			workPath = defaultWorkDir(audiobookOutput, audiobookStdout)
+		}
+
+		// A dry run only looks at the cache and the work directory, and
+		// leaves both as they are.
+		if audiobookDryRun {
+			var cache *audiobook.Cache
+			if !audiobookNoCache {
+				cache = audiobook.ReadCache(cacheDir)
+			}
+			var work *audiobook.WorkDir
+			if audiobookResume {
+				if work, err = audiobook.ReadWorkDir(workPath, &script, audiobookAPIFormat); err != nil {
+					return err
+				}
+			}
+			return printEstimate(os.Stdout, audiobook.EstimateScript(&script, cache, work, audiobookAPIFormat))
+		}
+
+		var cache *audiobook.Cache
+		if !audiobookNoCache {
+			cache, err = audiobook.OpenCache(cacheDir)
+			if err != nil {
+				return err
+			}
+		}
+
+		workDir, err := audiobook.OpenWorkDir(workPath, &script, audiobookAPIFormat, audiobookResume)
 		if err != nil {
 			return err
 		}
+		defer workDir.Close()
+
+		if err := checkQuota(cmd.Context(), &script, cache, workDir, audiobookAPIFormat, audiobookQuotaCheck); err != nil {
+			if workDir.Done() == 0 {
+				workDir.Remove()
+			}
+			return err
+		}
 
 		fmt.Fprintf(os.Stderr, "Generating audiobook (%d blocks)...\n", len(script.Blocks))
 
-		result, err := audiobook.Generate(&script, key, client)
+		result, err := audiobook.Generate(cmd.Context(), &script, client, audiobook.Options{
+			Concurrency: audiobookConcurrency,
+			Cache:       cache,
+			WorkDir:     workDir,
+			Format:      audiobookAPIFormat,
+			SampleRate:  sampleRate,
+			Channels:    channels,
+			Limiter:     audio.NewLimiter(audiobookCeiling, sampleRate),
+			Dither:      audiobookDither,
+		})
 		if err != nil {
+			fmt.Fprintf(os.Stderr, "%d rendered blocks saved in %s; rerun with --resume to continue\n",
+				workDir.Done(), workDir.Dir())
 			return fmt.Errorf("generation failed: %w", err)
 		}
+		defer result.Close()
 
-		mp3Data, err := audio.EncodePCMToMP3(result.MergedPCM)
-		if err != nil {
-			return fmt.Errorf("MP3 encoding failed: %w", err)
+		if cache != nil {
+			hits, misses := cache.Stats()
+			fmt.Fprintf(os.Stderr, "Cache: %d hits, %d misses (%s)\n", hits, misses, cache.Dir())
+			if audiobookCachePrune > 0 {
+				removed, err := cache.Prune(audiobookCachePrune)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "Cache: pruned %d entries unused for %s\n", removed, audiobookCachePrune)
+			}
+		}
+
+		ctx := cmd.Context()
+		rate, channels := result.SampleRate, result.Channels
+		gain := 0.0
+		if loudnessRequested(cmd) {
+			meter := audio.NewLoudnessMeter(rate, channels)
+			if err := copyPCM(ctx, meter, result.Mix.Reader(), 0); err != nil {
+				return err
+			}
+			gain = loudnessGain(meter.Loudness())
 		}
 
 		if audiobookKeepBlocks {
@@ -77,27 +224,87 @@ via the ElevenLabs API and merged into a single MP3 file.`,
 			if !audiobookStdout {
 				dir = filepath.Dir(audiobookOutput)
 			}
-			for i, pcm := range result.BlockPCMs {
-				blockMP3, err := audio.EncodePCMToMP3(pcm)
+			for i, block := range result.Blocks {
+				ch := result.BlockChannels[i]
+				blockPath := filepath.Join(dir, fmt.Sprintf("block_%03d.%s", i+1, format))
+				err := atomicfile.WriteFunc(blockPath, 0644, func(w io.Writer) error {
+					return encodeStream(ctx, w, io.NewSectionReader(block, 0, block.Size()),
+						format, rate, ch, int(block.Size())/(2*ch), 0)
+				})
 				if err != nil {
-					return fmt.Errorf("failed to encode block %d: %w", i, err)
-				}
-				blockPath := filepath.Join(dir, fmt.Sprintf("block_%03d.mp3", i+1))
-				if err := os.WriteFile(blockPath, blockMP3, 0644); err != nil {
 					return fmt.Errorf("failed to write %s: %w", blockPath, err)
 				}
 				fmt.Fprintf(os.Stderr, "Wrote %s\n", blockPath)
 			}
 		}
 
-		return writeOutput(mp3Data, audiobookOutput, audiobookStdout)
+		var tag []byte
+		if result.Tag != nil {
+			if format != "mp3" {
+				fmt.Fprintf(os.Stderr, "Note: metadata and chapters are only written to MP3 output\n")
+			} else if tag, err = audio.EncodeID3(result.Tag); err != nil {
+				return fmt.Errorf("failed to encode ID3 tag: %w", err)
+			}
+		}
+
+		mix := result.Mix.Reader()
+		err = writeOutputStream(audiobookOutput, audiobookStdout, func(w io.Writer) error {
+			if _, err := w.Write(tag); err != nil {
+				return err
+			}
+			return encodeStream(ctx, w, mix, format, rate, channels, result.Mix.Len(), gain)
+		})
+		if err != nil {
+			return err
+		}
+		reportLimiter(mix.Stats(), audiobookCeiling)
+		return workDir.Remove()
 	},
 }
 
+// reportLimiter tells the user on stderr when the limiter had to turn the
+// mix down, and how many samples would have clipped without it.
+func reportLimiter(stats audio.MixStats, ceiling float64) {
+	if stats.Peak <= ceiling {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Limiter: mix peaked at %+.1f dBFS, limited to %.1f dBFS", stats.Peak, ceiling)
+	if stats.Clipped > 0 {
+		fmt.Fprintf(os.Stderr, "; %d samples would have clipped", stats.Clipped)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+// defaultWorkDir returns the directory that holds finished blocks for a
+// render of outputPath, next to the output file.
+func defaultWorkDir(outputPath string, useStdout bool) string {
+	if useStdout {
+		return "audiobook.work"
+	}
+	return outputPath + ".work"
+}
+
 func init() {
 	audiobookCmd.Flags().StringVarP(&audiobookOutput, "output", "o", "audiobook.mp3", "Output file path")
-	audiobookCmd.Flags().BoolVar(&audiobookKeepBlocks, "keep-blocks", false, "Keep individual block audio files")
+	audiobookCmd.Flags().StringVarP(&audiobookFormat, "format", "f", "mp3", "Output format: mp3, wav or flac (default: from the --output extension, else mp3)")
+	audiobookCmd.Flags().BoolVar(&audiobookKeepBlocks, "keep-blocks", false, "Keep individual block audio files; each holds the block as rendered, without background layers mixed in")
 	audiobookCmd.Flags().BoolVar(&audiobookStdin, "stdin", false, "Read script JSON from stdin")
 	audiobookCmd.Flags().BoolVar(&audiobookStdout, "stdout", false, "Write audio to stdout")
+	audiobookCmd.Flags().IntVarP(&audiobookConcurrency, "concurrency", "j", 1, "Number of blocks to render in parallel")
+	audiobookCmd.Flags().BoolVar(&audiobookNoCache, "no-cache", false, "Render every block through the API, bypassing the block cache")
+	audiobookCmd.Flags().StringVar(&audiobookCacheDir, "cache-dir", "", "Block cache directory (default <user cache dir>/elevencli/blocks)")
+	audiobookCmd.Flags().DurationVar(&audiobookCachePrune, "cache-prune", 0, "After rendering, remove cached blocks unused for this long (e.g. 720h)")
+	audiobookCmd.Flags().StringVar(&audiobookWorkDir, "work-dir", "", "Directory for finished blocks and the run manifest (default <output>.work)")
+	audiobookCmd.Flags().BoolVar(&audiobookDryRun, "dry-run", false, "Validate the script, list the API calls and estimate cost and duration without rendering")
+	audiobookCmd.Flags().StringVar(&audiobookQuotaCheck, "quota-check", "warn", "When the estimated cost exceeds the remaining quota: warn, abort or off")
+	audiobookCmd.Flags().BoolVar(&audiobookResume, "resume", false, "Continue a failed or interrupted run from its work directory")
+	audiobookCmd.Flags().StringVar(&audiobookAPIFormat, "api-format", audiobook.DefaultFormat, "Raw format blocks are requested in: pcm_<rate>, ulaw_8000 or alaw_8000")
+	audiobookCmd.Flags().IntVar(&audiobookSampleRate, "sample-rate", 0, "Sample rate of the output in Hz (default: the --api-format rate)")
+	audiobookCmd.Flags().IntVar(&audiobookChannels, "channels", 0, "Output channels: 1 or 2 (default: 2 if the script pans any block, else 1)")
+	audiobookCmd.Flags().Float64Var(&audiobookCeiling, "ceiling", -1, "Ceiling of the mix limiter in dBFS; the limiter is always on, turning peaks above it down smoothly instead of clipping (0 only prevents clipping)")
+	audiobookCmd.Flags().BoolVar(&audiobookDither, "dither", false, "Mix blocks at full precision and dither the result to 16 bits")
+	addBitrateFlag(audiobookCmd)
+	addModeFlag(audiobookCmd)
+	addLoudnessFlags(audiobookCmd)
 	rootCmd.AddCommand(audiobookCmd)
 }
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/deegital/elevencli/internal/audiobook"
+)
+
+// printEstimate writes the dry-run report: one row per API call followed by
+// per-voice and per-model character totals, credits and duration.
+func printEstimate(out io.Writer, est *audiobook.Estimate) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "BLOCK\tTYPE\tVOICE\tMODEL\tCHARS\tCREDITS\tTEXT")
+	for _, c := range est.Calls {
+		credits := fmt.Sprintf("%g", c.Credits)
+		switch {
+		case c.Saved:
+			credits = "saved"
+		case c.Cached:
+			credits = "cached"
+		}
+		voice, model, chars := c.Voice, c.Model, fmt.Sprint(c.Chars)
+		if c.Type != "tts" {
+			voice, model, chars = "-", "-", "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.Block+1, c.Type, voice, model, chars, credits, truncate(c.Text, 40))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "API calls:  %d (%d cached)\n", len(est.Calls), countCached(est.Calls))
+	printTotals(out, "Characters by voice:", est.CharsByVoice, est.CachedCharsByVoice)
+	printTotals(out, "Characters by model:", est.CharsByModel, est.CachedCharsByModel)
+	fmt.Fprintf(out, "Estimated credits:   %g\n", est.Credits)
+	fmt.Fprintf(out, "Estimated duration:  %s\n", formatDuration(est.Duration))
+	return nil
+}
+
+// printTotals lists the character totals by key, with the part that is
+// cached and not billed in parentheses.
+func printTotals(out io.Writer, title string, totals, cached map[string]int) {
+	fmt.Fprintln(out, title)
+	if len(totals) == 0 {
+		fmt.Fprintln(out, "  (none)")
+		return
+	}
+	keys := make([]string, 0, len(totals))
+	for k := range totals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(out, "  %-28s %d", k, totals[k])
+		if n := cached[k]; n > 0 {
+			fmt.Fprintf(out, " (%d cached)", n)
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+func countCached(calls []audiobook.Call) int {
+	n := 0
+	for _, c := range calls {
+		if c.Cached || c.Saved {
+			n++
+		}
+	}
+	return n
+}
+
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+func formatDuration(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Second).String()
+}
+
+// checkQuota compares the estimated cost of rendering script, less the
+// blocks in the cache and in work from a previous run, with the account's
+// remaining character quota. Depending on mode it warns ("warn"),
+// fails ("abort") or does nothing ("off"). A failure to read the quota is
+// only reported, since API keys may lack permission to read the
+// subscription.
+func checkQuota(ctx context.Context, script *audiobook.Script, cache *audiobook.Cache, work *audiobook.WorkDir, format, mode string) error {
+	if mode == "off" {
+		return nil
+	}
+
+	est := audiobook.EstimateScript(script, cache, work, format)
+	if est.Credits == 0 {
+		return nil
+	}
+
+	sub, err := client.GetSubscription(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fmt.Fprintf(os.Stderr, "Warning: could not check quota: %v\n", err)
+		return nil
+	}
+
+	remaining := sub.CharactersRemaining()
+	if est.Credits <= float64(remaining) {
+		return nil
+	}
+
+	msg := fmt.Sprintf("estimated cost of %g credits exceeds the %d characters remaining in your quota", est.Credits, remaining)
+	if reset := sub.NextReset(); !reset.IsZero() {
+		msg += fmt.Sprintf(" (resets %s)", formatReset(reset, "2006-01-02"))
+	}
+	if mode == "abort" {
+		return fmt.Errorf("%s; use --quota-check=warn to render anyway", msg)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+	return nil
+}
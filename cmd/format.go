@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/deegital/elevencli/internal/audio"
+)
+
+// formatMap maps user-friendly format names to ElevenLabs API format strings.
+var formatMap = map[string]string{
+	"mp3":  "mp3_44100_128",
+	"pcm":  "pcm_44100",
+	"ulaw": "ulaw_8000",
+	"alaw": "alaw_8000",
+}
+
+// containerFormats are output formats the API does not offer. They are
+// fetched as PCM and encoded locally.
+var containerFormats = map[string]bool{
+	"wav":  true,
+	"flac": true,
+}
+
+// mp3Bitrate is the --bitrate of MP3 output in kbps.
+var mp3Bitrate int
+
+// mp3BitrateChoices are the values --bitrate accepts. The API delivers MP3
+// at 44.1 kHz in all of them.
+var mp3BitrateChoices = []int{64, 96, 128, 192}
+
+// addBitrateFlag registers --bitrate on cmd.
+func addBitrateFlag(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&mp3Bitrate, "bitrate", audio.DefaultMP3Bitrate, "MP3 bitrate in kbps: 64, 96, 128 or 192")
+}
+
+// validateBitrate checks --bitrate against the output format.
+func validateBitrate(cmd *cobra.Command, format string) error {
+	if !cmd.Flags().Changed("bitrate") {
+		return nil
+	}
+	if format != "mp3" {
+		return fmt.Errorf("--bitrate requires --format mp3")
+	}
+	if !slices.Contains(mp3BitrateChoices, mp3Bitrate) {
+		return fmt.Errorf("--bitrate must be one of: 64, 96, 128, 192")
+	}
+	return nil
+}
+
+// mp3Mode is the parsed --mode of MP3 output. Commands without the flag
+// keep MP3Auto, which follows the channel count of the audio.
+var mp3Mode audio.MP3Mode
+
+// mp3ModeName is the --mode as given.
+var mp3ModeName string
+
+// addModeFlag registers --mode on cmd. The API only delivers MP3 in its
+// own mode, so tts and sfx fetch PCM and encode locally when it is given.
+func addModeFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&mp3ModeName, "mode", "", "MP3 channel mode: stereo, dual-channel or mono (default: stereo for stereo audio, else mono)")
+}
+
+// validateMode checks --mode against the output format and parses it into
+// mp3Mode.
+func validateMode(cmd *cobra.Command, format string) error {
+	if !cmd.Flags().Changed("mode") {
+		return nil
+	}
+	if format != "mp3" {
+		return fmt.Errorf("--mode requires --format mp3")
+	}
+	mode, err := audio.ParseMP3Mode(mp3ModeName)
+	if err != nil {
+		return fmt.Errorf("--mode must be one of: stereo, dual-channel, mono")
+	}
+	mp3Mode = mode
+	return nil
+}
+
+// apiFormatPattern matches full API format names such as "pcm_16000" or
+// "mp3_22050_32", which are passed through unchanged.
+var apiFormatPattern = regexp.MustCompile(`^(mp3|pcm|ulaw|alaw|opus)_\d+(_\d+)?$`)
+
+func resolveFormat(f string) (string, error) {
+	if containerFormats[f] {
+		return formatMap["pcm"], nil
+	}
+	if mapped, ok := formatMap[f]; ok {
+		return mapped, nil
+	}
+	if apiFormatPattern.MatchString(f) {
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported format %q (supported: mp3, wav, flac, pcm, ulaw, alaw, or an API format such as pcm_16000)", f)
+}
+
+// outputFormat returns the --format of cmd. When the flag is not given, an
+// output path ending in .mp3, .wav or .flac selects that format.
+func outputFormat(cmd *cobra.Command, format, outputPath string) string {
+	if cmd.Flags().Changed("format") {
+		return format
+	}
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(outputPath), ".")); ext {
+	case "mp3", "wav", "flac":
+		return ext
+	}
+	return format
+}
+
+// fetchFormat returns the API format to request for output format f; "mp3"
+// is fetched at --bitrate. With process set the audio is decoded and re-encoded locally, so it must be
+// fetched in a raw format: "mp3" is fetched as PCM, like wav and flac.
+func fetchFormat(f string, process bool) (string, error) {
+	if f == "mp3" {
+		if process {
+			return formatMap["pcm"], nil
+		}
+		return fmt.Sprintf("mp3_44100_%d", mp3Bitrate), nil
+	}
+	apiFormat, err := resolveFormat(f)
+	if err != nil {
+		return "", err
+	}
+	if process {
+		if _, err := audio.ParseFormat(apiFormat); err != nil {
+			return "", fmt.Errorf("--loudness supports --format mp3, wav, flac or a raw pcm, ulaw or alaw format, not %q", f)
+		}
+	}
+	return apiFormat, nil
+}
+
+// encodeOutput turns audio fetched in apiFormat into the output format the
+// user asked for, normalizing its loudness first if normalize is set. Audio
+// the API already delivered in its final format is returned unchanged; MP3
+// fetched as PCM is encoded here.
+func encodeOutput(data []byte, format, apiFormat string, normalize bool) ([]byte, error) {
+	local := containerFormats[format] || format == "mp3" && !strings.HasPrefix(apiFormat, "mp3_")
+	if !normalize && !local {
+		return data, nil
+	}
+	f, err := audio.ParseFormat(apiFormat)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := audio.Decode(data, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode audio: %w", err)
+	}
+
+	pcm := buf.PCM16()
+	if normalize {
+		pcm = normalizeLoudness(pcm, f.SampleRate, f.Channels)
+	}
+	switch {
+	case format == "mp3" || containerFormats[format]:
+		return encodePCM(pcm, format, f.SampleRate, f.Channels)
+	case f.Encoding == audio.PCM16:
+		return pcm, nil
+	}
+	normalized, err := audio.Decode(pcm, buf.Format(audio.PCM16))
+	if err != nil {
+		return nil, err
+	}
+	return normalized.Encode(f.Encoding), nil
+}
+
+// encodePCM encodes 16-bit PCM as mp3, wav or flac. MP3 is encoded at
+// --bitrate in mp3Mode.
+func encodePCM(pcm []byte, format string, sampleRate, channels int) ([]byte, error) {
+	switch format {
+	case "mp3":
+		return audio.EncodeMP3(pcm, sampleRate, channels, mp3Bitrate, mp3Mode)
+	case "wav":
+		return audio.EncodeWAV(pcm, sampleRate, channels), nil
+	case "flac":
+		return audio.EncodeFLAC(pcm, sampleRate, channels), nil
+	}
+	return nil, fmt.Errorf("unsupported output format %q", format)
+}
+
+// streamChunk is the number of bytes of PCM copyPCM moves at a time.
+const streamChunk = 1 << 20
+
+// newEncoder returns a writer that encodes 16-bit PCM as mp3, wav or flac
+// to w as it is written. frames is the length of the audio, which the WAV
+// and FLAC headers record up front. Close flushes the encoder but does not
+// close w.
+func newEncoder(w io.Writer, format string, sampleRate, channels, frames int) (io.WriteCloser, error) {
+	switch format {
+	case "mp3":
+		return audio.NewMP3Writer(w, sampleRate, channels, mp3Bitrate, mp3Mode)
+	case "wav":
+		return audio.NewWAVWriter(w, sampleRate, channels, frames)
+	case "flac":
+		return audio.NewFLACWriter(w, sampleRate, channels, frames)
+	}
+	return nil, fmt.Errorf("unsupported output format %q", format)
+}
+
+// encodeStream encodes frames frames of 16-bit PCM from src as format to w,
+// changing their level by gainDB decibels.
+func encodeStream(ctx context.Context, w io.Writer, src io.Reader, format string, sampleRate, channels, frames int, gainDB float64) error {
+	enc, err := newEncoder(w, format, sampleRate, channels, frames)
+	if err != nil {
+		return err
+	}
+	if err := copyPCM(ctx, enc, src, gainDB); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// copyPCM copies 16-bit PCM from src to dst a chunk at a time, changing its
+// level by gainDB decibels. It stops early if ctx is cancelled.
+func copyPCM(ctx context.Context, dst io.Writer, src io.Reader, gainDB float64) error {
+	buf := make([]byte, streamChunk)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := io.ReadFull(src, buf)
+		if n > 0 {
+			chunk := buf[:n]
+			if gainDB != 0 {
+				chunk = audio.ApplyGain(chunk, gainDB)
+			}
+			if _, err := dst.Write(chunk); err != nil {
+				return err
+			}
+		}
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/deegital/elevencli/internal/audio"
+)
+
+var (
+	loudnessTarget  float64
+	truePeakCeiling float64
+)
+
+// addLoudnessFlags registers --loudness and --true-peak on cmd.
+func addLoudnessFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&loudnessTarget, "loudness", 0, "Normalize integrated loudness to this target in LUFS (e.g. -16)")
+	cmd.Flags().Float64Var(&truePeakCeiling, "true-peak", -1, "True-peak ceiling in dBTP when normalizing loudness")
+}
+
+// loudnessRequested reports whether the user asked for normalization.
+func loudnessRequested(cmd *cobra.Command) bool {
+	return cmd.Flags().Changed("loudness")
+}
+
+func validateLoudnessFlags(cmd *cobra.Command) error {
+	if !loudnessRequested(cmd) {
+		if cmd.Flags().Changed("true-peak") {
+			return fmt.Errorf("--true-peak requires --loudness")
+		}
+		return nil
+	}
+	if loudnessTarget < -70 || loudnessTarget >= 0 {
+		return fmt.Errorf("--loudness must be between -70 and 0 LUFS, got %g", loudnessTarget)
+	}
+	if truePeakCeiling > 0 {
+		return fmt.Errorf("--true-peak must not be above 0 dBTP, got %g", truePeakCeiling)
+	}
+	return nil
+}
+
+// normalizeLoudness brings 16-bit PCM to --loudness without exceeding
+// --true-peak and reports the measurement on stderr.
+func normalizeLoudness(pcm []byte, sampleRate, channels int) []byte {
+	gain := loudnessGain(audio.MeasureLoudness(pcm, sampleRate, channels))
+	if gain == 0 {
+		return pcm
+	}
+	return audio.ApplyGain(pcm, gain)
+}
+
+// loudnessGain returns the gain in dB that brings audio measured as before
+// to --loudness without exceeding --true-peak, and reports the measurement
+// on stderr.
+func loudnessGain(before audio.Loudness) float64 {
+	if math.IsInf(before.Integrated, -1) {
+		fmt.Fprintf(os.Stderr, "Loudness: audio is silent, not normalized\n")
+		return 0
+	}
+
+	gain := audio.NormalizationGain(before, loudnessTarget, truePeakCeiling)
+	fmt.Fprintf(os.Stderr, "Loudness: %.1f LUFS, true peak %.1f dBTP; applying %+.1f dB\n",
+		before.Integrated, before.TruePeak, gain)
+	if result := before.Integrated + gain; result < loudnessTarget-0.05 {
+		fmt.Fprintf(os.Stderr, "Loudness: limited by the %.1f dBTP ceiling; output is %.1f LUFS\n",
+			truePeakCeiling, result)
+	}
+	return gain
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/deegital/elevencli/internal/mockserver"
+)
+
+var (
+	mockAddr    string
+	mockLatency time.Duration
+	mockQuiet   bool
+)
+
+var mockServerCmd = &cobra.Command{
+	Use:   "mock-server",
+	Short: "Run a local fake ElevenLabs API for offline development",
+	Long: `Run a local stand-in for the ElevenLabs API that serves text-to-speech,
+sound-generation and voice listing with deterministic synthesized audio.
+No credits are used and no network access is needed. Point other commands at
+it with --base-url (any API key is accepted):
+
+  elevencli mock-server --addr 127.0.0.1:8787 &
+  elevencli --base-url http://127.0.0.1:8787 --api-key test audiobook examples/story.json`,
+	Annotations: map[string]string{"noAuth": "true"},
+	Args:        cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := mockserver.Options{Latency: mockLatency}
+		if !mockQuiet {
+			logger := log.New(os.Stderr, "", log.LstdFlags)
+			opts.Logf = logger.Printf
+		}
+
+		ln, err := net.Listen("tcp", mockAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", mockAddr, err)
+		}
+		srv := &http.Server{Handler: mockserver.New(opts)}
+
+		fmt.Fprintf(os.Stderr, "Mock ElevenLabs API listening on http://%s\n", ln.Addr())
+
+		errc := make(chan error, 1)
+		go func() { errc <- srv.Serve(ln) }()
+
+		select {
+		case err := <-errc:
+			return err
+		case <-cmd.Context().Done():
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+		if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	mockServerCmd.Flags().StringVar(&mockAddr, "addr", "127.0.0.1:8787", "Address to listen on")
+	mockServerCmd.Flags().DurationVar(&mockLatency, "latency", 0, "Artificial delay added to every audio response")
+	mockServerCmd.Flags().BoolVarP(&mockQuiet, "quiet", "q", false, "Do not log requests")
+	rootCmd.AddCommand(mockServerCmd)
+}
@@ -2,21 +2,24 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	elevenlabs "github.com/haguro/elevenlabs-go"
 	"github.com/spf13/cobra"
 
 	"github.com/deegital/elevencli/internal/config"
+	"github.com/deegital/elevencli/internal/elevenlabs"
 )
 
 var (
-	version       = "0.1.0"
-	apiKey        string
-	resolvedKey   string
-	client        *elevenlabs.Client
+	version = "0.1.0"
+	apiKey  string
+	baseURL string
+	client  *elevenlabs.Client
 )
 
 var banner = `
@@ -31,36 +34,85 @@ var rootCmd = &cobra.Command{
 	Short:   "ElevenLabs CLI — text-to-speech and sound effects from the command line",
 	Long:    banner,
 	Version: version,
+	// Execute prints errors itself, so it can leave out interruptions.
+	SilenceErrors: true,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Flags and arguments are valid at this point; later errors are
+		// not about usage.
+		cmd.SilenceUsage = true
 		config.Init()
-		if cmd.Annotations["noAuth"] == "true" {
+		config.BindFlags(cmd.Flags())
+		if !needsAuth(cmd) {
 			return nil
 		}
 		key, err := config.ResolveAPIKey(apiKey)
 		if err != nil {
 			return err
 		}
-		resolvedKey = key
-		client = elevenlabs.NewClient(context.Background(), key, 120*time.Second)
+		url, err := config.ResolveBaseURL(baseURL)
+		if err != nil {
+			return err
+		}
+		attempts, maxWait, err := config.ResolveRetry()
+		if err != nil {
+			return err
+		}
+		client = elevenlabs.NewClient(elevenlabs.Options{
+			BaseURL:     url,
+			APIKey:      key,
+			UserAgent:   "elevencli/" + version,
+			MaxAttempts: attempts,
+			MaxWait:     maxWait,
+			OnRetry: func(attempt int, wait time.Duration, err error) {
+				fmt.Fprintf(os.Stderr, "Request failed (attempt %d/%d): %v; retrying in %s...\n",
+					attempt, attempts, err, wait.Round(100*time.Millisecond))
+			},
+		})
 		return nil
 	},
 }
 
-// resolveAPIKeyValue returns the resolved API key for direct HTTP calls.
-func resolveAPIKeyValue() (string, error) {
-	if resolvedKey != "" {
-		return resolvedKey, nil
-	}
-	return "", fmt.Errorf("API key not resolved")
-}
-
 func init() {
 	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", "", "ElevenLabs API key")
+	rootCmd.PersistentFlags().StringVar(&baseURL, "base-url", "", "API base URL (default https://api.elevenlabs.io)")
+	rootCmd.PersistentFlags().Int("max-attempts", elevenlabs.DefaultMaxAttempts, "Maximum tries per API request on 429/5xx/network errors (1 disables retries)")
+	rootCmd.PersistentFlags().Duration("max-retry-wait", elevenlabs.DefaultMaxWait, "Maximum delay between retries, including Retry-After")
+}
+
+// needsAuth reports whether cmd talks to the API. Commands opt out with the
+// "noAuth" annotation, or with "noAuthFlag" naming a boolean flag (such as
+// --dry-run) that makes the run offline when set.
+func needsAuth(cmd *cobra.Command) bool {
+	if cmd.Annotations["noAuth"] == "true" {
+		return false
+	}
+	if name := cmd.Annotations["noAuthFlag"]; name != "" {
+		if on, err := cmd.Flags().GetBool(name); err == nil && on {
+			return false
+		}
+	}
+	return true
 }
 
+// Execute runs the root command. The first SIGINT or SIGTERM cancels the
+// command's context so in-flight requests stop and partial output is
+// discarded; a second signal terminates the process immediately. A command
+// that gives up because of the cancellation exits with status 130; one that
+// handles the signal and returns normally exits with status 0.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "Interrupted")
+		os.Exit(130)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
 	}
 }
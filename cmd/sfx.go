@@ -1,14 +1,12 @@
 package cmd
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"github.com/deegital/elevencli/internal/elevenlabs"
 )
 
 var (
@@ -19,11 +17,6 @@ var (
 	sfxStdout   bool
 )
 
-type soundGenRequest struct {
-	Text            string  `json:"text"`
-	DurationSeconds float64 `json:"duration_seconds,omitempty"`
-}
-
 var sfxCmd = &cobra.Command{
 	Use:   "sfx [prompt]",
 	Short: "Generate a sound effect from a text description",
@@ -33,12 +26,18 @@ var sfxCmd = &cobra.Command{
 			return err
 		}
 
-		apiFormat, err := resolveFormat(sfxFormat)
-		if err != nil {
+		if err := validateLoudnessFlags(cmd); err != nil {
 			return err
 		}
-
-		key, err := resolveAPIKeyValue()
+		normalize := loudnessRequested(cmd)
+		format := outputFormat(cmd, sfxFormat, sfxOutput)
+		if err := validateBitrate(cmd, format); err != nil {
+			return err
+		}
+		if err := validateMode(cmd, format); err != nil {
+			return err
+		}
+		apiFormat, err := fetchFormat(format, normalize || cmd.Flags().Changed("mode"))
 		if err != nil {
 			return err
 		}
@@ -48,51 +47,34 @@ var sfxCmd = &cobra.Command{
 			return err
 		}
 
-		req := soundGenRequest{Text: prompt}
+		req := elevenlabs.SoundGenerationRequest{Text: prompt}
 		if sfxDuration > 0 {
 			req.DurationSeconds = sfxDuration
 		}
 
-		body, err := json.Marshal(req)
-		if err != nil {
-			return fmt.Errorf("failed to build request: %w", err)
-		}
-
-		url := fmt.Sprintf("https://api.elevenlabs.io/v1/sound-generation?output_format=%s", apiFormat)
-		httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
-		if err != nil {
-			return fmt.Errorf("failed to create request: %w", err)
-		}
-		httpReq.Header.Set("Content-Type", "application/json")
-		httpReq.Header.Set("xi-api-key", key)
-
 		fmt.Fprintf(os.Stderr, "Generating sound effect...\n")
 
-		resp, err := http.DefaultClient.Do(httpReq)
+		data, err := client.SoundGeneration(cmd.Context(), req, apiFormat)
 		if err != nil {
 			return fmt.Errorf("SFX request failed: %w", err)
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			respBody, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("API error (%d): %s", resp.StatusCode, string(respBody))
-		}
-
-		audio, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("failed to read response: %w", err)
+		if data, err = encodeOutput(data, format, apiFormat, normalize); err != nil {
+			return err
 		}
 
-		return writeOutput(audio, sfxOutput, sfxStdout)
+		return writeOutput(data, sfxOutput, sfxStdout)
 	},
 }
 
 func init() {
 	sfxCmd.Flags().StringVarP(&sfxOutput, "output", "o", "output.mp3", "Output file path")
 	sfxCmd.Flags().Float64VarP(&sfxDuration, "duration", "d", 0, "Duration in seconds (0.5-30)")
-	sfxCmd.Flags().StringVarP(&sfxFormat, "format", "f", "mp3", "Output format: mp3, pcm, ulaw")
+	sfxCmd.Flags().StringVarP(&sfxFormat, "format", "f", "mp3", "Output format: mp3, wav, flac, pcm, ulaw, alaw, or an API format such as pcm_16000 (default: from the --output extension, else mp3)")
 	sfxCmd.Flags().BoolVar(&sfxStdin, "stdin", false, "Read prompt from stdin")
 	sfxCmd.Flags().BoolVar(&sfxStdout, "stdout", false, "Write audio to stdout")
+	addBitrateFlag(sfxCmd)
+	addModeFlag(sfxCmd)
+	addLoudnessFlags(sfxCmd)
 	rootCmd.AddCommand(sfxCmd)
 }
@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
+
+	"github.com/deegital/elevencli/internal/atomicfile"
 )
 
 func validateStdinArgs(cmd *cobra.Command, args []string, useStdin, useStdout bool) error {
@@ -42,7 +45,25 @@ func writeOutput(audioData []byte, outputPath string, useStdout bool) error {
 		_, err := os.Stdout.Write(audioData)
 		return err
 	}
-	if err := os.WriteFile(outputPath, audioData, 0644); err != nil {
+	if err := atomicfile.Write(outputPath, audioData, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputPath, err)
+	}
+	fmt.Println(outputPath)
+	return nil
+}
+
+// writeOutputStream is writeOutput for audio produced incrementally: write
+// is called with stdout or the output file, which only appears once write
+// has succeeded.
+func writeOutputStream(outputPath string, useStdout bool, write func(io.Writer) error) error {
+	if useStdout {
+		w := bufio.NewWriter(os.Stdout)
+		if err := write(w); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	if err := atomicfile.WriteFunc(outputPath, 0644, write); err != nil {
 		return fmt.Errorf("failed to write %s: %w", outputPath, err)
 	}
 	fmt.Println(outputPath)
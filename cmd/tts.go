@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"os"
 
-	elevenlabs "github.com/haguro/elevenlabs-go"
 	"github.com/spf13/cobra"
+
+	"github.com/deegital/elevencli/internal/elevenlabs"
 )
 
 var (
@@ -15,21 +16,13 @@ var (
 	ttsModel  string
 	ttsStdin  bool
 	ttsStdout bool
-)
 
-// formatMap maps user-friendly format names to ElevenLabs API format strings.
-var formatMap = map[string]string{
-	"mp3":  "mp3_44100_128",
-	"pcm":  "pcm_44100",
-	"ulaw": "ulaw_8000",
-}
-
-func resolveFormat(f string) (string, error) {
-	if mapped, ok := formatMap[f]; ok {
-		return mapped, nil
-	}
-	return "", fmt.Errorf("unsupported format %q (supported: mp3, pcm, ulaw)", f)
-}
+	ttsStability       float64
+	ttsSimilarityBoost float64
+	ttsStyle           float64
+	ttsSpeakerBoost    bool
+	ttsSpeed           float64
+)
 
 var ttsCmd = &cobra.Command{
 	Use:   "tts [text]",
@@ -45,37 +38,94 @@ var ttsCmd = &cobra.Command{
 			return fmt.Errorf("--voice is required. Use 'elevencli voices' to list available voices")
 		}
 
-		apiFormat, err := resolveFormat(ttsFormat)
+		if err := validateLoudnessFlags(cmd); err != nil {
+			return err
+		}
+		normalize := loudnessRequested(cmd)
+		format := outputFormat(cmd, ttsFormat, ttsOutput)
+		if err := validateBitrate(cmd, format); err != nil {
+			return err
+		}
+		if err := validateMode(cmd, format); err != nil {
+			return err
+		}
+		apiFormat, err := fetchFormat(format, normalize || cmd.Flags().Changed("mode"))
 		if err != nil {
 			return err
 		}
 
+		settings := ttsVoiceSettings(cmd)
+		if err := settings.Validate(); err != nil {
+			return err
+		}
+
 		text, err := readTextFromStdinOrArg(ttsStdin, args)
 		if err != nil {
 			return err
 		}
 
-		fmt.Fprintf(os.Stderr, "Generating speech...\n")
-
-		audio, err := client.TextToSpeech(ttsVoice, elevenlabs.TextToSpeechRequest{
+		req := elevenlabs.TextToSpeechRequest{
 			Text:    text,
 			ModelID: ttsModel,
-		}, elevenlabs.OutputFormat(apiFormat))
+		}
+		if !settings.IsZero() {
+			req.VoiceSettings = &settings
+		}
+
+		fmt.Fprintf(os.Stderr, "Generating speech...\n")
+
+		data, err := client.TextToSpeech(cmd.Context(), ttsVoice, req, apiFormat)
 		if err != nil {
 			return fmt.Errorf("TTS request failed: %w", err)
 		}
 
-		return writeOutput(audio, ttsOutput, ttsStdout)
+		if data, err = encodeOutput(data, format, apiFormat, normalize); err != nil {
+			return err
+		}
+
+		return writeOutput(data, ttsOutput, ttsStdout)
 	},
 }
 
+// ttsVoiceSettings collects the voice settings given on the command line.
+// Only flags the user actually set are sent, so e.g. --stability 0 is honored
+// while an omitted flag keeps the voice's stored value.
+func ttsVoiceSettings(cmd *cobra.Command) elevenlabs.VoiceSettings {
+	var s elevenlabs.VoiceSettings
+	flags := cmd.Flags()
+	if flags.Changed("stability") {
+		s.Stability = &ttsStability
+	}
+	if flags.Changed("similarity-boost") {
+		s.SimilarityBoost = &ttsSimilarityBoost
+	}
+	if flags.Changed("style") {
+		s.Style = &ttsStyle
+	}
+	if flags.Changed("speaker-boost") {
+		s.UseSpeakerBoost = &ttsSpeakerBoost
+	}
+	if flags.Changed("speed") {
+		s.Speed = &ttsSpeed
+	}
+	return s
+}
+
 func init() {
 	ttsCmd.Flags().StringVarP(&ttsVoice, "voice", "v", "", "Voice ID (required)")
 	ttsCmd.Flags().StringVarP(&ttsOutput, "output", "o", "output.mp3", "Output file path")
-	ttsCmd.Flags().StringVarP(&ttsFormat, "format", "f", "mp3", "Output format: mp3, pcm, ulaw")
+	ttsCmd.Flags().StringVarP(&ttsFormat, "format", "f", "mp3", "Output format: mp3, wav, flac, pcm, ulaw, alaw, or an API format such as pcm_16000 (default: from the --output extension, else mp3)")
 	ttsCmd.Flags().StringVarP(&ttsModel, "model", "m", "eleven_multilingual_v2", "Model ID")
+	ttsCmd.Flags().Float64Var(&ttsStability, "stability", 0, "Voice stability (0.0-1.0)")
+	ttsCmd.Flags().Float64Var(&ttsSimilarityBoost, "similarity-boost", 0, "Voice similarity boost (0.0-1.0)")
+	ttsCmd.Flags().Float64Var(&ttsStyle, "style", 0, "Style exaggeration (0.0-1.0)")
+	ttsCmd.Flags().BoolVar(&ttsSpeakerBoost, "speaker-boost", false, "Enable speaker boost (--speaker-boost=false to disable)")
+	ttsCmd.Flags().Float64Var(&ttsSpeed, "speed", 1.0, "Speaking speed (0.7-1.2)")
 	ttsCmd.Flags().BoolVar(&ttsStdin, "stdin", false, "Read text from stdin")
 	ttsCmd.Flags().BoolVar(&ttsStdout, "stdout", false, "Write audio to stdout")
 	_ = ttsCmd.MarkFlagRequired("voice")
+	addBitrateFlag(ttsCmd)
+	addModeFlag(ttsCmd)
+	addLoudnessFlags(ttsCmd)
 	rootCmd.AddCommand(ttsCmd)
 }
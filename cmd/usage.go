@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var usageJSON bool
+
+// usageReport is the --json output of the usage command.
+type usageReport struct {
+	Tier                string `json:"tier"`
+	Status              string `json:"status,omitempty"`
+	CharactersUsed      int    `json:"characters_used"`
+	CharactersLimit     int    `json:"characters_limit"`
+	CharactersRemaining int    `json:"characters_remaining"`
+	NextReset           string `json:"next_reset,omitempty"`
+	VoiceSlotsUsed      int    `json:"voice_slots_used"`
+	VoiceLimit          int    `json:"voice_limit"`
+}
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show subscription tier and character quota",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sub, err := client.GetSubscription(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get subscription: %w", err)
+		}
+
+		if usageJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(usageReport{
+				Tier:                sub.Tier,
+				Status:              sub.Status,
+				CharactersUsed:      sub.CharacterCount,
+				CharactersLimit:     sub.CharacterLimit,
+				CharactersRemaining: sub.CharactersRemaining(),
+				NextReset:           formatReset(sub.NextReset(), time.RFC3339),
+				VoiceSlotsUsed:      sub.VoiceSlotsUsed,
+				VoiceLimit:          sub.VoiceLimit,
+			})
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Tier\t%s\n", sub.Tier)
+		if sub.Status != "" {
+			fmt.Fprintf(w, "Status\t%s\n", sub.Status)
+		}
+		fmt.Fprintf(w, "Characters used\t%d / %d (%.1f%%)\n",
+			sub.CharacterCount, sub.CharacterLimit, percent(sub.CharacterCount, sub.CharacterLimit))
+		fmt.Fprintf(w, "Characters remaining\t%d\n", sub.CharactersRemaining())
+		fmt.Fprintf(w, "Resets\t%s\n", formatReset(sub.NextReset(), "2006-01-02 15:04 MST"))
+		fmt.Fprintf(w, "Voice slots\t%d / %d\n", sub.VoiceSlotsUsed, sub.VoiceLimit)
+		return w.Flush()
+	},
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
+
+func formatReset(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(layout)
+}
+
+func init() {
+	usageCmd.Flags().BoolVar(&usageJSON, "json", false, "Print usage as JSON")
+	rootCmd.AddCommand(usageCmd)
+}
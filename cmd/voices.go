@@ -15,7 +15,7 @@ var voicesCmd = &cobra.Command{
 	Use:   "voices",
 	Short: "List available voices",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		voices, err := client.GetVoices()
+		voices, err := client.GetVoices(cmd.Context())
 		if err != nil {
 			return fmt.Errorf("failed to list voices: %w", err)
 		}
@@ -28,7 +28,7 @@ var voicesCmd = &cobra.Command{
 				continue
 			}
 			labels := formatLabels(v.Labels)
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.VoiceId, v.Name, v.Category, labels)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.VoiceID, v.Name, v.Category, labels)
 		}
 		return w.Flush()
 	},
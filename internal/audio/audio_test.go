@@ -0,0 +1,35 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// tone returns frames frames of a sine at freq Hz with a peak of dbfs, as
+// 16-bit PCM with the same signal in each of channels channels.
+func tone(sampleRate, channels, frames int, freq, dbfs float64) []byte {
+	amp := 32767 * DBToGain(dbfs)
+	pcm := make([]byte, frames*channels*2)
+	for i := range frames {
+		v := int16(math.Round(amp * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate))))
+		for c := range channels {
+			binary.LittleEndian.PutUint16(pcm[(i*channels+c)*2:], uint16(v))
+		}
+	}
+	return pcm
+}
+
+// peak returns the largest absolute sample value of 16-bit PCM.
+func peak(pcm []byte) int {
+	p := 0
+	for i := 0; i+1 < len(pcm); i += 2 {
+		v := int(int16(binary.LittleEndian.Uint16(pcm[i:])))
+		p = max(p, v, -v)
+	}
+	return p
+}
+
+// db converts a linear amplitude factor to decibels.
+func db(gain float64) float64 {
+	return 20 * math.Log10(gain)
+}
@@ -0,0 +1,178 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Buffer is decoded audio: interleaved samples in [-1, 1] at a known sample
+// rate and channel count.
+type Buffer struct {
+	SampleRate int
+	Channels   int
+	Samples    []float32
+}
+
+// NewBuffer returns a silent buffer of the given length in frames.
+func NewBuffer(sampleRate, channels, frames int) *Buffer {
+	return &Buffer{
+		SampleRate: sampleRate,
+		Channels:   channels,
+		Samples:    make([]float32, frames*channels),
+	}
+}
+
+// Decode converts raw audio in format f to a Buffer. A trailing partial
+// frame is an error, since it means the data is not in format f.
+func Decode(data []byte, f Format) (*Buffer, error) {
+	if f.Channels < 1 || f.SampleRate < 1 {
+		return nil, fmt.Errorf("invalid audio format %+v", f)
+	}
+	if len(data)%f.frameSize() != 0 {
+		return nil, fmt.Errorf("%d bytes is not a whole number of %s frames", len(data), f)
+	}
+
+	b := &Buffer{SampleRate: f.SampleRate, Channels: f.Channels}
+	switch f.Encoding {
+	case PCM16:
+		b.Samples = make([]float32, len(data)/2)
+		for i := range b.Samples {
+			b.Samples[i] = float32(int16(binary.LittleEndian.Uint16(data[i*2:]))) / 32768
+		}
+	case MuLaw:
+		b.Samples = make([]float32, len(data))
+		for i, v := range data {
+			b.Samples[i] = float32(ulawToLinear(v)) / 32768
+		}
+	case ALaw:
+		b.Samples = make([]float32, len(data))
+		for i, v := range data {
+			b.Samples[i] = float32(alawToLinear(v)) / 32768
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encoding %d", f.Encoding)
+	}
+	return b, nil
+}
+
+// DecodeFile decodes a WAV, MP3 or FLAC file, recognized by its contents,
+// to a Buffer at the file's own sample rate and channel count.
+func DecodeFile(data []byte) (*Buffer, error) {
+	// Tagging tools put ID3v2 tags in front of FLAC streams as well as MP3s.
+	body := data[id3Size(data):]
+	switch {
+	case len(body) >= 12 && string(body[0:4]) == "RIFF" && string(body[8:12]) == "WAVE":
+		return decodeWAV(body)
+	case bytes.HasPrefix(body, []byte("fLaC")):
+		return decodeFLAC(body)
+	case len(body) >= 2 && body[0] == 0xff && body[1]&0xe0 == 0xe0:
+		return decodeMP3(data)
+	}
+	return nil, errors.New("not a WAV, MP3 or FLAC file")
+}
+
+// id3Size returns the length of the ID3v2 tag at the start of data, or 0 if
+// there is none.
+func id3Size(data []byte) int {
+	if len(data) < 10 || string(data[0:3]) != "ID3" {
+		return 0
+	}
+	// The size is a 28-bit number stored 7 bits per byte.
+	size := 10 + (int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9]))
+	if data[5]&0x10 != 0 { // footer present
+		size += 10
+	}
+	return min(size, len(data))
+}
+
+// Mono returns b mixed down to a single channel by averaging its channels.
+func (b *Buffer) Mono() *Buffer {
+	if b.Channels == 1 {
+		return b
+	}
+	out := NewBuffer(b.SampleRate, 1, b.Frames())
+	scale := 1 / float32(b.Channels)
+	for i := range out.Samples {
+		sum := float32(0)
+		for _, v := range b.Samples[i*b.Channels : (i+1)*b.Channels] {
+			sum += v
+		}
+		out.Samples[i] = sum * scale
+	}
+	return out
+}
+
+// DualMono reports whether b has more than one channel and every channel
+// holds the same samples, as in a mono recording stored as stereo.
+func (b *Buffer) DualMono() bool {
+	if b.Channels < 2 {
+		return false
+	}
+	for i := 0; i < len(b.Samples); i += b.Channels {
+		for _, v := range b.Samples[i+1 : i+b.Channels] {
+			if v != b.Samples[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Format returns the raw format of b when encoded with e.
+func (b *Buffer) Format(e Encoding) Format {
+	return Format{SampleRate: b.SampleRate, Channels: b.Channels, Encoding: e}
+}
+
+// Encode converts b to raw audio with encoding e, clamping samples outside
+// [-1, 1].
+func (b *Buffer) Encode(e Encoding) []byte {
+	switch e {
+	case MuLaw:
+		out := make([]byte, len(b.Samples))
+		for i, s := range b.Samples {
+			out[i] = linearToULaw(toInt16(s))
+		}
+		return out
+	case ALaw:
+		out := make([]byte, len(b.Samples))
+		for i, s := range b.Samples {
+			out[i] = linearToALaw(toInt16(s))
+		}
+		return out
+	}
+	out := make([]byte, len(b.Samples)*2)
+	for i, s := range b.Samples {
+		binary.LittleEndian.PutUint16(out[i*2:], uint16(toInt16(s)))
+	}
+	return out
+}
+
+// PCM16 returns b as 16-bit little-endian PCM.
+func (b *Buffer) PCM16() []byte {
+	return b.Encode(PCM16)
+}
+
+// Frames returns the length of b in frames (samples per channel).
+func (b *Buffer) Frames() int {
+	if b.Channels == 0 {
+		return 0
+	}
+	return len(b.Samples) / b.Channels
+}
+
+// Duration returns the length of b in seconds.
+func (b *Buffer) Duration() float64 {
+	return Seconds(b.Frames(), b.SampleRate)
+}
+
+// Silence returns seconds of silence encoded in format f.
+func Silence(seconds float64, f Format) []byte {
+	return NewBuffer(f.SampleRate, f.Channels, Samples(seconds, f.SampleRate)).Encode(f.Encoding)
+}
+
+func toInt16(s float32) int16 {
+	return clamp16(int32(math.Round(float64(s) * 32768)))
+}
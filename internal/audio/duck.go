@@ -0,0 +1,107 @@
+package audio
+
+import "math"
+
+// Ducking turns a clip down while the timeline's key clips (usually
+// narration) are audible, like a compressor fed from a sidechain.
+type Ducking struct {
+	// Depth is the attenuation in dB applied while the key is active.
+	Depth float64
+	// Threshold is the key level in dBFS above which ducking engages.
+	Threshold float64
+	// Attack is the number of samples over which the clip is turned down.
+	// The attenuation starts this far ahead of the key so it is complete
+	// by the time the key becomes audible.
+	Attack int
+	// Release is the number of samples over which the clip recovers after
+	// the key falls silent.
+	Release int
+}
+
+// keyWindow is the RMS window used to detect key activity, short enough to
+// follow syllables and long enough to ignore single-sample spikes.
+const keyWindow = 0.01
+
+// keyLevel mixes the key clips of t and returns their short-term RMS level,
+// as a fraction of full scale, at every sample from position from up to to
+// of a timeline n samples long. Only the key audio around that range is
+// read, so the level can be computed a chunk at a time.
+func (t *Timeline) keyLevel(from, to, n int, scratch []byte) ([]float64, error) {
+	rate := t.SampleRate
+	if rate == 0 {
+		rate = SampleRate
+	}
+	half := max(Samples(keyWindow, rate)/2, 1)
+
+	// The key mix covers [lo, hi), the range the RMS windows reach into.
+	lo, hi := max(from-half, 0), min(to+half, n)
+	key := make([]float64, hi-lo)
+	for _, c := range t.clips {
+		if !c.Key {
+			continue
+		}
+		start, end := max(lo, c.Start), min(hi, c.End())
+		if start >= end {
+			continue
+		}
+		pcm, err := c.read(start-c.Start, end-c.Start, scratch)
+		if err != nil {
+			return nil, err
+		}
+		scratch = pcm
+		m := c.Samples()
+		gain := DBToGain(c.GainDB)
+		for p := start; p < end; p++ {
+			i := p - c.Start
+			v := c.sample(pcm, p-start, 0, 1) / 32768
+			key[p-lo] += v * c.level(i, m, gain)
+		}
+	}
+
+	// Prefix sums of squares give the windowed RMS in O(n).
+	sums := make([]float64, len(key)+1)
+	for i, v := range key {
+		sums[i+1] = sums[i] + v*v
+	}
+	level := make([]float64, to-from)
+	for i := range level {
+		a, b := max(from+i-half, 0), min(from+i+half, n)
+		level[i] = math.Sqrt((sums[b-lo] - sums[a-lo]) / float64(b-a))
+	}
+	return level, nil
+}
+
+// ducker follows the gain of one ducked clip sample by sample. The
+// attenuation moves linearly in dB, reaching Depth after Attack samples and
+// recovering after Release samples.
+type ducker struct {
+	d               *Ducking
+	threshold       float64
+	down, up        float64
+	reduction, gain float64
+}
+
+func newDucker(d *Ducking) *ducker {
+	return &ducker{
+		d:         d,
+		threshold: DBToGain(d.Threshold),
+		down:      d.Depth / float64(max(d.Attack, 1)),
+		up:        d.Depth / float64(max(d.Release, 1)),
+		gain:      1,
+	}
+}
+
+// next returns the gain of the clip's next sample given the key level Attack
+// samples ahead of it.
+func (k *ducker) next(level float64) float64 {
+	prev := k.reduction
+	if level > k.threshold {
+		k.reduction = min(k.reduction+k.down, k.d.Depth)
+	} else {
+		k.reduction = max(k.reduction-k.up, 0)
+	}
+	if k.reduction != prev {
+		k.gain = DBToGain(-k.reduction)
+	}
+	return k.gain
+}
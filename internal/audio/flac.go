@@ -0,0 +1,543 @@
+package audio
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"io"
+	"math/bits"
+)
+
+// The FLAC encoder writes 16-bit streams using the fixed linear predictors
+// of the format (orders 0 to 4) with partitioned Rice coding of the
+// residual, and picks the best of the four stereo decorrelation modes for
+// every stereo frame, comparable to the fastest presets of the reference
+// encoder. It is written here because go-audio has no FLAC support and the
+// mewkiz/flac encoder seeks back to fill in the stream length and closes
+// the writer it is given, so it cannot stream to stdout, and it codes each
+// subframe with a single Rice partition and no stereo decorrelation.
+const (
+	// flacBlockSize is the number of frames (samples per channel) in every
+	// FLAC frame but the last.
+	flacBlockSize = 4096
+	// flacMaxPartitionOrder bounds the Rice partitioning: at most
+	// 2^flacMaxPartitionOrder partitions per subframe.
+	flacMaxPartitionOrder = 6
+	// flacMaxRiceParam is the largest parameter of the 4-bit Rice coding
+	// method; 15 is reserved as the escape code.
+	flacMaxRiceParam = 14
+)
+
+// FLAC channel assignments for stereo decorrelation.
+const (
+	flacLeftSide  = 8
+	flacSideRight = 9
+	flacMidSide   = 10
+)
+
+// flacMD5Offset is the position of the MD5 signature in a stream: after
+// the "fLaC" marker, the metadata block header and 18 bytes of STREAMINFO.
+const flacMD5Offset = 4 + 4 + 18
+
+// EncodeFLAC encodes 16-bit PCM with the given sample rate and number of
+// interleaved channels (1 to 8) as a FLAC stream.
+func EncodeFLAC(pcm []byte, sampleRate, channels int) []byte {
+	frames := len(pcm) / 2 / channels
+	pcm = pcm[:frames*channels*2]
+
+	var buf bytes.Buffer
+	w, _ := NewFLACWriter(&buf, sampleRate, channels, frames) // a bytes.Buffer never fails
+	w.Write(pcm)
+	w.Close()
+	out := buf.Bytes()
+	sum := md5.Sum(pcm)
+	copy(out[flacMD5Offset:], sum[:])
+	return out
+}
+
+// FLACWriter encodes 16-bit PCM written to it as FLAC, writing each FLAC
+// frame to the underlying writer as soon as it is complete. The stream
+// header is written first, so the length must be known in advance; the MD5
+// signature of the audio is left unset, which the format allows.
+type FLACWriter struct {
+	w          io.Writer
+	sampleRate int
+	// samples holds the block being filled, one slice per channel.
+	samples [][]int32
+	// n is the number of frames in samples, and frame the number of FLAC
+	// frames written.
+	n, frame int
+	// partial holds the bytes of a PCM frame split between two writes.
+	partial []byte
+	out     bitWriter
+	err     error
+}
+
+// NewFLACWriter writes the header of a FLAC stream holding frames frames of
+// 16-bit PCM with the given sample rate and number of interleaved channels
+// (1 to 8) to w, and returns a FLACWriter for the audio.
+func NewFLACWriter(w io.Writer, sampleRate, channels, frames int) (*FLACWriter, error) {
+	f := &FLACWriter{
+		w:          w,
+		sampleRate: sampleRate,
+		samples:    make([][]int32, channels),
+	}
+	for c := range f.samples {
+		f.samples[c] = make([]int32, flacBlockSize)
+	}
+
+	h := &f.out
+	h.bytes([]byte("fLaC"))
+
+	// STREAMINFO, the only metadata block.
+	h.bits(1, 1) // last metadata block
+	h.bits(0, 7)
+	h.bits(34, 24)
+	h.bits(flacBlockSize, 16)
+	h.bits(flacBlockSize, 16)
+	h.bits(0, 24) // minimum and maximum frame size unknown
+	h.bits(0, 24)
+	h.bits(uint64(sampleRate), 20)
+	h.bits(uint64(channels-1), 3)
+	h.bits(BitDepth-1, 5)
+	h.bits(uint64(frames), 36)
+	h.bytes(make([]byte, md5.Size)) // MD5 signature unset
+	if err := f.flushOut(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write encodes p, which may end in the middle of a sample or block; the
+// remainder is kept for the next call.
+func (f *FLACWriter) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	written := len(p)
+	size := len(f.samples) * 2
+	if len(f.partial) > 0 {
+		k := min(size-len(f.partial), len(p))
+		f.partial = append(f.partial, p[:k]...)
+		p = p[k:]
+		if len(f.partial) < size {
+			return written, nil
+		}
+		f.push(f.partial)
+		f.partial = f.partial[:0]
+	}
+	for ; len(p) >= size && f.err == nil; p = p[size:] {
+		f.push(p)
+	}
+	f.partial = append(f.partial, p...)
+	if f.err != nil {
+		return 0, f.err
+	}
+	return written, nil
+}
+
+// push adds the first PCM frame of p to the block, encoding the block once
+// it is full.
+func (f *FLACWriter) push(p []byte) {
+	for c := range f.samples {
+		f.samples[c][f.n] = int32(int16(binary.LittleEndian.Uint16(p[c*2:])))
+	}
+	f.n++
+	if f.n == flacBlockSize {
+		f.flush()
+	}
+}
+
+// flush encodes the frames in the block.
+func (f *FLACWriter) flush() {
+	block := make([][]int32, len(f.samples))
+	for c, x := range f.samples {
+		block[c] = x[:f.n]
+	}
+	writeFLACFrame(&f.out, f.frame, f.sampleRate, block)
+	f.frame++
+	f.n = 0
+	if err := f.flushOut(); err != nil {
+		f.err = err
+	}
+}
+
+// flushOut writes the completed bytes of out to the underlying writer.
+func (f *FLACWriter) flushOut() error {
+	_, err := f.w.Write(f.out.buf)
+	f.out.buf = f.out.buf[:0]
+	return err
+}
+
+// Close encodes the last, shorter block. It does not close the underlying
+// writer.
+func (f *FLACWriter) Close() error {
+	if f.err == nil && f.n > 0 {
+		f.flush()
+	}
+	return f.err
+}
+
+// writeFLACFrame writes frame number n holding one block of samples per
+// channel.
+func writeFLACFrame(w *bitWriter, n, sampleRate int, samples [][]int32) {
+	size := len(samples[0])
+	assignment := len(samples) - 1
+	subframes := make([]*bitWriter, len(samples))
+	for c, x := range samples {
+		subframes[c] = encodeSubframe(x, BitDepth)
+	}
+	if len(samples) == 2 {
+		left, right := samples[0], samples[1]
+		mid, side := make([]int32, size), make([]int32, size)
+		for i := range size {
+			mid[i] = (left[i] + right[i]) >> 1
+			side[i] = left[i] - right[i]
+		}
+		// The side channel needs one extra bit.
+		m, s := encodeSubframe(mid, BitDepth), encodeSubframe(side, BitDepth+1)
+		l, r := subframes[0], subframes[1]
+		best := l.len() + r.len()
+		for _, c := range []struct {
+			assignment int
+			a, b       *bitWriter
+		}{
+			{flacLeftSide, l, s},
+			{flacSideRight, s, r},
+			{flacMidSide, m, s},
+		} {
+			if total := c.a.len() + c.b.len(); total < best {
+				best, assignment, subframes = total, c.assignment, []*bitWriter{c.a, c.b}
+			}
+		}
+	}
+
+	start := len(w.buf)
+	w.bits(0x3ffe, 14) // sync code
+	w.bits(0, 1)
+	w.bits(0, 1) // fixed block size
+	w.bits(7, 4) // block size in 16 bits after the frame number
+	rateCode, rateBits, rateValue := flacRateCode(sampleRate)
+	w.bits(rateCode, 4)
+	w.bits(uint64(assignment), 4)
+	w.bits(4, 3) // 16 bits per sample
+	w.bits(0, 1)
+	w.utf8(uint64(n))
+	w.bits(uint64(size-1), 16)
+	if rateBits > 0 {
+		w.bits(rateValue, rateBits)
+	}
+	w.bits(uint64(crc8(w.buf[start:])), 8)
+
+	for _, s := range subframes {
+		w.append(s)
+	}
+	w.align()
+	w.bits(uint64(crc16(w.buf[start:])), 16)
+}
+
+// flacRateCode returns the frame header code for sampleRate and, for rates
+// without a code of their own, the trailing field that holds it.
+func flacRateCode(sampleRate int) (code uint64, n uint, value uint64) {
+	switch sampleRate {
+	case 8000:
+		return 4, 0, 0
+	case 16000:
+		return 5, 0, 0
+	case 22050:
+		return 6, 0, 0
+	case 24000:
+		return 7, 0, 0
+	case 32000:
+		return 8, 0, 0
+	case 44100:
+		return 9, 0, 0
+	case 48000:
+		return 10, 0, 0
+	case 96000:
+		return 11, 0, 0
+	}
+	if sampleRate <= 0xffff {
+		return 13, 16, uint64(sampleRate)
+	}
+	return 0, 0, 0 // taken from STREAMINFO
+}
+
+// encodeSubframe returns the smallest encoding of one channel of a block:
+// constant, fixed-predictor or verbatim. bps is the sample width in bits.
+func encodeSubframe(x []int32, bps uint) *bitWriter {
+	w := &bitWriter{}
+	constant := true
+	for _, v := range x[1:] {
+		if v != x[0] {
+			constant = false
+			break
+		}
+	}
+	if constant {
+		w.bits(0, 8)
+		w.signed(x[0], bps)
+		return w
+	}
+
+	order := bestFixedOrder(x)
+	residual := fixedResidual(x, order)
+	w.bits(uint64(0x08|order)<<1, 8)
+	for _, v := range x[:order] {
+		w.signed(v, bps)
+	}
+	writeResidual(w, residual, len(x), order)
+
+	if verbatim := 8 + len(x)*int(bps); w.len() > verbatim {
+		w = &bitWriter{}
+		w.bits(1<<1, 8)
+		for _, v := range x {
+			w.signed(v, bps)
+		}
+	}
+	return w
+}
+
+// bestFixedOrder picks the fixed predictor order with the smallest total
+// absolute residual.
+func bestFixedOrder(x []int32) int {
+	best, order := uint64(1<<63), 0
+	for o := 0; o <= 4 && o < len(x); o++ {
+		sum := uint64(0)
+		for _, r := range fixedResidual(x, o) {
+			sum += uint64(abs64(int64(r)))
+		}
+		if sum < best {
+			best, order = sum, o
+		}
+	}
+	return order
+}
+
+// fixedResidual returns the prediction error of the fixed predictor of the
+// given order for every sample after the first order warm-up samples.
+func fixedResidual(x []int32, order int) []int32 {
+	r := make([]int32, len(x)-order)
+	for i := order; i < len(x); i++ {
+		var p int32
+		switch order {
+		case 1:
+			p = x[i-1]
+		case 2:
+			p = 2*x[i-1] - x[i-2]
+		case 3:
+			p = 3*x[i-1] - 3*x[i-2] + x[i-3]
+		case 4:
+			p = 4*x[i-1] - 6*x[i-2] + 4*x[i-3] - x[i-4]
+		}
+		r[i-order] = x[i] - p
+	}
+	return r
+}
+
+// writeResidual Rice-codes the residual of a block of size samples with
+// the partition order and parameters that give the fewest bits.
+func writeResidual(w *bitWriter, residual []int32, size, predictorOrder int) {
+	folded := make([]uint32, len(residual))
+	for i, r := range residual {
+		folded[i] = uint32(r<<1) ^ uint32(r>>31)
+	}
+
+	bestOrder, bestBits := 0, -1
+	var bestParams []uint
+	for po := 0; po <= flacMaxPartitionOrder; po++ {
+		if size%(1<<po) != 0 || size>>po <= predictorOrder {
+			break
+		}
+		params := make([]uint, 1<<po)
+		total := 0
+		for p, part := range partitions(folded, size, po, predictorOrder) {
+			params[p], total = riceParam(part), total+4
+			total += riceBits(part, params[p])
+		}
+		if bestBits < 0 || total < bestBits {
+			bestOrder, bestBits, bestParams = po, total, params
+		}
+	}
+
+	w.bits(0, 2) // 4-bit Rice parameters
+	w.bits(uint64(bestOrder), 4)
+	for p, part := range partitions(folded, size, bestOrder, predictorOrder) {
+		k := bestParams[p]
+		w.bits(uint64(k), 4)
+		for _, u := range part {
+			w.unary(uint64(u >> k))
+			w.bits(uint64(u)&(1<<k-1), k)
+		}
+	}
+}
+
+// partitions splits the folded residual into 2^order partitions of a block
+// of size samples; the first is shorter by the predictor's warm-up.
+func partitions(folded []uint32, size, order, predictorOrder int) [][]uint32 {
+	parts := make([][]uint32, 1<<order)
+	n := size >> order
+	start := 0
+	for p := range parts {
+		end := start + n
+		if p == 0 {
+			end -= predictorOrder
+		}
+		parts[p] = folded[start:end]
+		start = end
+	}
+	return parts
+}
+
+// riceParam estimates the best Rice parameter for a partition from its
+// mean.
+func riceParam(part []uint32) uint {
+	if len(part) == 0 {
+		return 0
+	}
+	sum := uint64(0)
+	for _, u := range part {
+		sum += uint64(u)
+	}
+	mean := sum / uint64(len(part))
+	if mean == 0 {
+		return 0
+	}
+	return min(uint(bits.Len64(mean))-1, flacMaxRiceParam)
+}
+
+// riceBits returns the coded size of a partition with Rice parameter k.
+func riceBits(part []uint32, k uint) int {
+	n := len(part) * int(k+1)
+	for _, u := range part {
+		n += int(u >> k)
+	}
+	return n
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// bitWriter accumulates a big-endian bit stream.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+// bits writes the low n bits of v, n <= 56.
+func (w *bitWriter) bits(v uint64, n uint) {
+	for n > 0 {
+		take := min(n, 56-w.nbits)
+		n -= take
+		w.acc = w.acc<<take | (v>>n)&(1<<take-1)
+		w.nbits += take
+		for w.nbits >= 8 {
+			w.nbits -= 8
+			w.buf = append(w.buf, byte(w.acc>>w.nbits))
+		}
+	}
+}
+
+// signed writes v as an n-bit two's complement number.
+func (w *bitWriter) signed(v int32, n uint) {
+	w.bits(uint64(int64(v))&(1<<n-1), n)
+}
+
+// unary writes q zero bits followed by a one.
+func (w *bitWriter) unary(q uint64) {
+	for ; q >= 32; q -= 32 {
+		w.bits(0, 32)
+	}
+	w.bits(1, uint(q)+1)
+}
+
+func (w *bitWriter) bytes(b []byte) {
+	for _, v := range b {
+		w.bits(uint64(v), 8)
+	}
+}
+
+// utf8 writes v in the extended UTF-8 coding FLAC uses for frame numbers.
+func (w *bitWriter) utf8(v uint64) {
+	if v < 0x80 {
+		w.bits(v, 8)
+		return
+	}
+	n := uint(2)
+	for v >= 1<<(5*n+1) {
+		n++
+	}
+	w.bits((0xff00>>n)&0xff|v>>(6*(n-1)), 8)
+	for i := int(n) - 2; i >= 0; i-- {
+		w.bits(0x80|(v>>(6*uint(i)))&0x3f, 8)
+	}
+}
+
+// align pads the stream with zero bits to a byte boundary.
+func (w *bitWriter) align() {
+	if w.nbits > 0 {
+		w.bits(0, 8-w.nbits)
+	}
+}
+
+// len returns the number of bits written.
+func (w *bitWriter) len() int {
+	return len(w.buf)*8 + int(w.nbits)
+}
+
+// append copies the bits of o onto w.
+func (w *bitWriter) append(o *bitWriter) {
+	if w.nbits == 0 {
+		w.buf = append(w.buf, o.buf...)
+	} else {
+		w.bytes(o.buf)
+	}
+	w.bits(o.acc&(1<<o.nbits-1), o.nbits)
+}
+
+// crc8 is the FLAC frame header checksum: polynomial x^8+x^2+x+1.
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for range 8 {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// crc16Table holds the FLAC frame checksum, polynomial x^16+x^15+x^2+1, of
+// every byte value.
+var crc16Table = func() [256]uint16 {
+	var t [256]uint16
+	for i := range t {
+		crc := uint16(i) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}()
+
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
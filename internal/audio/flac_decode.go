@@ -0,0 +1,409 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// decodeFLAC decodes a FLAC stream of any bit depth from 4 to 32 bits into a
+// Buffer. Frame checksums are verified, so a damaged file fails to decode
+// instead of playing noise.
+func decodeFLAC(data []byte) (*Buffer, error) {
+	r := &bitReader{buf: data}
+	if r.bits(32) != 0x664c6143 { // "fLaC"
+		return nil, errors.New("not a FLAC stream")
+	}
+
+	var rate, channels, depth int
+	var total uint64
+	for last := false; !last; {
+		last = r.bits(1) == 1
+		kind := r.bits(7)
+		size := int(r.bits(24))
+		start := r.offset()
+		if kind == 0 { // STREAMINFO
+			r.bits(32) // minimum and maximum block size
+			r.bits(48) // minimum and maximum frame size
+			rate = int(r.bits(20))
+			channels = int(r.bits(3)) + 1
+			depth = int(r.bits(5)) + 1
+			total = r.bits(36)
+		}
+		if r.err != nil || start+size > len(data) {
+			return nil, errors.New("FLAC metadata is truncated")
+		}
+		r.seek(start + size)
+	}
+	if rate == 0 {
+		return nil, errors.New("FLAC stream has no STREAMINFO or a sample rate of 0")
+	}
+
+	b := &Buffer{SampleRate: rate, Channels: channels}
+	if total > 0 {
+		b.Samples = make([]float32, 0, min(total*uint64(channels), 1<<24))
+	}
+	scale := 1 / float32(uint64(1)<<(depth-1))
+	x := make([][]int32, channels)
+	frames := uint64(0)
+	for r.offset() < len(data) && (total == 0 || frames < total) {
+		n, err := decodeFLACFrame(r, x, depth)
+		if err != nil {
+			if frames > 0 && total == 0 && errors.Is(err, errFLACSync) {
+				break // trailing tags after the last frame
+			}
+			return nil, fmt.Errorf("FLAC frame at byte %d: %w", r.offset(), err)
+		}
+		for i := range n {
+			for c := range x {
+				b.Samples = append(b.Samples, float32(x[c][i])*scale)
+			}
+		}
+		frames += uint64(n)
+	}
+	return b, nil
+}
+
+var errFLACSync = errors.New("lost frame sync")
+
+// flacDepths maps the bit depth codes of frame headers to bits per sample.
+var flacDepths = [8]int{1: 8, 2: 12, 4: 16, 5: 20, 6: 24, 7: 32}
+
+// decodeFLACFrame decodes the frame at the current position of r into x,
+// one slice per channel, and returns its length in samples. depth is the
+// bit depth from STREAMINFO.
+func decodeFLACFrame(r *bitReader, x [][]int32, depth int) (int, error) {
+	start := r.offset()
+	if r.bits(14) != 0x3ffe {
+		return 0, errFLACSync
+	}
+	r.bits(2) // reserved bit and blocking strategy
+	sizeCode := r.bits(4)
+	rateCode := r.bits(4)
+	assignment := int(r.bits(4))
+	depthCode := r.bits(3)
+	r.bits(1)
+	r.utf8() // frame or sample number
+
+	var n int
+	switch {
+	case sizeCode == 1:
+		n = 192
+	case sizeCode >= 2 && sizeCode <= 5:
+		n = 576 << (sizeCode - 2)
+	case sizeCode == 6:
+		n = int(r.bits(8)) + 1
+	case sizeCode == 7:
+		n = int(r.bits(16)) + 1
+	case sizeCode >= 8:
+		n = 256 << (sizeCode - 8)
+	default:
+		return 0, errors.New("reserved block size")
+	}
+	switch rateCode {
+	case 12:
+		r.bits(8)
+	case 13, 14:
+		r.bits(16)
+	case 15:
+		return 0, errors.New("invalid sample rate")
+	}
+	switch depthCode {
+	case 0: // as in STREAMINFO
+	case 3:
+		return 0, errors.New("reserved bit depth")
+	default:
+		depth = flacDepths[depthCode]
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	if crc := crc8(r.buf[start:r.offset()]); byte(r.bits(8)) != crc {
+		return 0, errors.New("header checksum mismatch")
+	}
+
+	channels := assignment + 1
+	if assignment >= flacLeftSide {
+		if assignment > flacMidSide {
+			return 0, errors.New("reserved channel assignment")
+		}
+		channels = 2
+	}
+	if channels != len(x) {
+		return 0, fmt.Errorf("%d channels in a %d-channel stream", channels, len(x))
+	}
+	for c := range x {
+		if cap(x[c]) < n {
+			x[c] = make([]int32, n)
+		}
+		x[c] = x[c][:n]
+		d := depth
+		// The side channel needs one more bit than the others.
+		if (assignment == flacLeftSide || assignment == flacMidSide) && c == 1 ||
+			assignment == flacSideRight && c == 0 {
+			d++
+		}
+		if err := decodeSubframe(r, x[c], d); err != nil {
+			return 0, fmt.Errorf("channel %d: %w", c, err)
+		}
+	}
+	r.align()
+	if r.err != nil {
+		return 0, r.err
+	}
+	if crc := crc16(r.buf[start:r.offset()]); uint16(r.bits(16)) != crc {
+		return 0, errors.New("checksum mismatch")
+	}
+
+	switch assignment {
+	case flacLeftSide:
+		for i := range n {
+			x[1][i] = x[0][i] - x[1][i]
+		}
+	case flacSideRight:
+		for i := range n {
+			x[0][i] += x[1][i]
+		}
+	case flacMidSide:
+		for i := range n {
+			side := x[1][i]
+			mid := x[0][i]<<1 | side&1
+			x[0][i] = (mid + side) >> 1
+			x[1][i] = (mid - side) >> 1
+		}
+	}
+	return n, nil
+}
+
+// decodeSubframe decodes one channel of a frame into x, whose length is the
+// block size, at the given bit depth.
+func decodeSubframe(r *bitReader, x []int32, depth int) error {
+	if depth > 32 {
+		return errors.New("samples wider than 32 bits are not supported")
+	}
+	r.bits(1) // zero padding
+	kind := int(r.bits(6))
+	wasted := 0
+	if r.bits(1) == 1 {
+		wasted = int(r.unary()) + 1
+		depth -= wasted
+	}
+
+	switch {
+	case kind == 0: // CONSTANT
+		v := r.signed(depth)
+		for i := range x {
+			x[i] = v
+		}
+	case kind == 1: // VERBATIM
+		for i := range x {
+			x[i] = r.signed(depth)
+		}
+	case kind >= 8 && kind <= 12: // FIXED
+		order := kind - 8
+		if err := decodeWarmup(r, x, order, depth); err != nil {
+			return err
+		}
+		if err := decodeResidual(r, x, order); err != nil {
+			return err
+		}
+		for i := order; i < len(x); i++ {
+			switch order {
+			case 1:
+				x[i] += x[i-1]
+			case 2:
+				x[i] += 2*x[i-1] - x[i-2]
+			case 3:
+				x[i] += 3*x[i-1] - 3*x[i-2] + x[i-3]
+			case 4:
+				x[i] += 4*x[i-1] - 6*x[i-2] + 4*x[i-3] - x[i-4]
+			}
+		}
+	case kind >= 32: // LPC
+		order := kind - 31
+		if err := decodeWarmup(r, x, order, depth); err != nil {
+			return err
+		}
+		precision := int(r.bits(4)) + 1
+		if precision == 16 {
+			return errors.New("invalid LPC precision")
+		}
+		shift := r.signed(5)
+		if shift < 0 {
+			return errors.New("negative LPC shift")
+		}
+		coefs := make([]int64, order)
+		for j := range coefs {
+			coefs[j] = int64(r.signed(precision))
+		}
+		if err := decodeResidual(r, x, order); err != nil {
+			return err
+		}
+		for i := order; i < len(x); i++ {
+			sum := int64(0)
+			for j, c := range coefs {
+				sum += c * int64(x[i-1-j])
+			}
+			x[i] += int32(sum >> shift)
+		}
+	default:
+		return fmt.Errorf("reserved subframe type %d", kind)
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	if wasted > 0 {
+		for i := range x {
+			x[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+// decodeWarmup reads the first order samples of a predicted subframe.
+func decodeWarmup(r *bitReader, x []int32, order, depth int) error {
+	if order > len(x) {
+		return errors.New("predictor order exceeds the block size")
+	}
+	for i := range order {
+		x[i] = r.signed(depth)
+	}
+	return nil
+}
+
+// decodeResidual reads the Rice-coded residual of a subframe into x after
+// the order warm-up samples.
+func decodeResidual(r *bitReader, x []int32, order int) error {
+	paramBits, escape := 4, uint64(15)
+	switch r.bits(2) {
+	case 0:
+	case 1:
+		paramBits, escape = 5, 31
+	default:
+		return errors.New("reserved residual coding method")
+	}
+	partitions := 1 << r.bits(4)
+	size := len(x) / partitions
+	if size*partitions != len(x) || size < order {
+		return errors.New("invalid residual partitioning")
+	}
+
+	i := order
+	for p := range partitions {
+		end := (p + 1) * size
+		k := r.bits(paramBits)
+		if k == escape {
+			width := int(r.bits(5))
+			for ; i < end; i++ {
+				x[i] = r.signed(width)
+			}
+			continue
+		}
+		for ; i < end; i++ {
+			u := r.unary()<<k | r.bits(int(k))
+			x[i] = int32(u>>1) ^ -int32(u&1)
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+	return nil
+}
+
+// bitReader reads a big-endian bit stream from a byte slice. Reading past
+// the end sets err and returns zeros.
+type bitReader struct {
+	buf []byte
+	// pos is the next byte to load into acc, whose top n bits are the next
+	// bits of the stream.
+	pos int
+	acc uint64
+	n   int
+	err error
+}
+
+func (r *bitReader) fill() {
+	for r.n <= 56 && r.pos < len(r.buf) {
+		r.acc |= uint64(r.buf[r.pos]) << (56 - r.n)
+		r.pos++
+		r.n += 8
+	}
+}
+
+// bits reads an n-bit unsigned number, n <= 56.
+func (r *bitReader) bits(n int) uint64 {
+	if r.n < n {
+		r.fill()
+		if r.n < n {
+			r.err = io.ErrUnexpectedEOF
+			r.acc, r.n = 0, 0
+			return 0
+		}
+	}
+	v := r.acc >> (64 - n)
+	r.acc <<= n
+	r.n -= n
+	return v
+}
+
+// signed reads an n-bit two's complement number, n <= 32.
+func (r *bitReader) signed(n int) int32 {
+	if n == 0 {
+		return 0
+	}
+	v := r.bits(n)
+	return int32(int64(v<<(64-n)) >> (64 - n))
+}
+
+// unary reads zero bits up to the next one and returns how many there were.
+func (r *bitReader) unary() uint64 {
+	q := uint64(0)
+	for {
+		if r.n == 0 {
+			r.fill()
+			if r.n == 0 {
+				r.err = io.ErrUnexpectedEOF
+				return 0
+			}
+		}
+		if z := bits.LeadingZeros64(r.acc); z < r.n {
+			r.acc <<= z + 1
+			r.n -= z + 1
+			return q + uint64(z)
+		}
+		q += uint64(r.n)
+		r.acc, r.n = 0, 0
+	}
+}
+
+// utf8 reads a number in the extended UTF-8 coding of frame headers.
+func (r *bitReader) utf8() uint64 {
+	first := r.bits(8)
+	length := bits.LeadingZeros8(^uint8(first))
+	if length == 0 {
+		return first
+	}
+	v := first & (1<<(7-length) - 1)
+	for range length - 1 {
+		v = v<<6 | r.bits(8)&0x3f
+	}
+	return v
+}
+
+// align skips to the next byte boundary.
+func (r *bitReader) align() {
+	r.bits(r.n % 8)
+}
+
+// offset returns the position of the next byte to read; the reader must be
+// byte-aligned.
+func (r *bitReader) offset() int {
+	return r.pos - r.n/8
+}
+
+// seek moves to byte off.
+func (r *bitReader) seek(off int) {
+	r.pos, r.acc, r.n = off, 0, 0
+}
@@ -0,0 +1,280 @@
+package audio
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+func TestFLACRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	noise := func(frames, channels int) []byte {
+		pcm := make([]byte, frames*channels*2)
+		for i := 0; i < len(pcm); i += 2 {
+			binary.LittleEndian.PutUint16(pcm[i:], uint16(rng.IntN(65536)))
+		}
+		return pcm
+	}
+	// Full-scale extremes stress the residual coding.
+	extremes := make([]byte, 3000*2)
+	for i := 0; i < len(extremes); i += 4 {
+		binary.LittleEndian.PutUint16(extremes[i:], 0x8000)
+		binary.LittleEndian.PutUint16(extremes[i+2:], 0x7fff)
+	}
+
+	tests := []struct {
+		name       string
+		sampleRate int
+		channels   int
+		pcm        []byte
+	}{
+		{"mono tone", 44100, 1, tone(44100, 1, 10000, 440, -6)},
+		{"stereo tone", 48000, 2, tone(48000, 2, 4096*3, 997, -1)},
+		{"stereo noise", 22050, 2, noise(5000, 2)},
+		{"mono noise", 16000, 1, noise(4097, 1)},
+		{"silence", 8000, 1, make([]byte, 2*1000)},
+		{"extremes", 44100, 2, extremes},
+		{"one frame", 11025, 2, noise(1, 2)},
+		{"odd rate", 12345, 1, tone(12345, 1, 2000, 100, -3)},
+		{"empty", 44100, 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := EncodeFLAC(tt.pcm, tt.sampleRate, tt.channels)
+			buf, err := DecodeFile(data)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if buf.SampleRate != tt.sampleRate || buf.Channels != tt.channels {
+				t.Errorf("got %d Hz, %d channels; want %d Hz, %d channels", buf.SampleRate, buf.Channels, tt.sampleRate, tt.channels)
+			}
+			if got := buf.PCM16(); !bytes.Equal(got, tt.pcm) {
+				t.Errorf("decoded %d bytes differ from the %d encoded", len(got), len(tt.pcm))
+			}
+		})
+	}
+}
+
+func TestFLACWriterMatchesEncodeFLAC(t *testing.T) {
+	pcm := tone(44100, 2, 10000, 440, -3)
+	want := EncodeFLAC(pcm, 44100, 2)
+
+	var buf bytes.Buffer
+	w, err := NewFLACWriter(&buf, 44100, 2, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writes that split frames and samples.
+	for p := pcm; len(p) > 0; {
+		n := min(777, len(p))
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The writer leaves the MD5 signature unset; everything else matches.
+	got := buf.Bytes()
+	if len(got) != len(want) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(want))
+	}
+	md5 := flacMD5Offset + 16
+	if !bytes.Equal(got[:flacMD5Offset], want[:flacMD5Offset]) || !bytes.Equal(got[md5:], want[md5:]) {
+		t.Error("streamed FLAC differs from EncodeFLAC")
+	}
+}
+
+// TestFLACReferenceDecoder checks the encoder's output against an
+// independent decoder, which verifies the frame checksums, and the MD5
+// signature against the audio.
+func TestFLACReferenceDecoder(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	// A tone with noise exercises every predictor order and stereo mode.
+	signal := func(frames, channels int) []byte {
+		pcm := tone(44100, channels, frames, 330, -3)
+		for i := 0; i < len(pcm); i += 2 {
+			v := int(int16(binary.LittleEndian.Uint16(pcm[i:]))) * 9 / 10
+			binary.LittleEndian.PutUint16(pcm[i:], uint16(v+rng.IntN(2001)-1000))
+		}
+		return pcm
+	}
+	for _, tt := range []struct {
+		sampleRate, channels, frames int
+	}{
+		{44100, 2, 3*flacBlockSize + 100},
+		{48000, 1, flacBlockSize},
+		{22050, 2, 17},
+		{96000, 2, 5000},
+		{12345, 1, 5000},
+	} {
+		pcm := signal(tt.frames, tt.channels)
+		data := EncodeFLAC(pcm, tt.sampleRate, tt.channels)
+		stream, err := flac.New(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%+v: %v", tt, err)
+		}
+		info := stream.Info
+		if int(info.SampleRate) != tt.sampleRate || int(info.NChannels) != tt.channels ||
+			info.BitsPerSample != 16 || int(info.NSamples) != tt.frames {
+			t.Errorf("%+v: STREAMINFO says %d Hz, %d channels, %d bits, %d samples",
+				tt, info.SampleRate, info.NChannels, info.BitsPerSample, info.NSamples)
+		}
+		if info.MD5sum != md5.Sum(pcm) {
+			t.Errorf("%+v: MD5 signature does not match the audio", tt)
+		}
+		var got []byte
+		for {
+			f, err := stream.ParseNext()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%+v: frame %d: %v", tt, len(got)/2/tt.channels, err)
+			}
+			for i := range int(f.BlockSize) {
+				for _, sub := range f.Subframes {
+					got = binary.LittleEndian.AppendUint16(got, uint16(sub.Samples[i]))
+				}
+			}
+		}
+		if !bytes.Equal(got, pcm) {
+			t.Errorf("%+v: reference decoder disagrees", tt)
+		}
+	}
+}
+
+// TestFLACDecodesReferenceEncoder decodes streams from an independent
+// encoder using the coding tools this package's encoder never emits: LPC
+// subframes, wasted bits, escaped and 5-bit Rice partitions, and depths
+// other than 16 bits.
+func TestFLACDecodesReferenceEncoder(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	// rice partitions a subframe into at most 2^order partitions; the
+	// block size must divide evenly between them.
+	rice := func(sf *frame.Subframe, order int, param uint) *frame.RiceSubframe {
+		for sf.NSamples%(1<<order) != 0 {
+			order--
+		}
+		parts := make([]frame.RicePartition, 1<<order)
+		for i := range parts {
+			parts[i].Param = param
+		}
+		return &frame.RiceSubframe{PartOrder: order, Partitions: parts}
+	}
+	// Subframe codings, applied to every channel of a frame.
+	codings := map[string]func(sf *frame.Subframe){
+		"verbatim": func(sf *frame.Subframe) { sf.Pred = frame.PredVerbatim },
+		"fixed": func(sf *frame.Subframe) {
+			sf.Pred, sf.Order = frame.PredFixed, 2
+			sf.RiceSubframe = rice(sf, 2, 9)
+		},
+		"lpc": func(sf *frame.Subframe) {
+			sf.Pred, sf.Order = frame.PredFIR, 4
+			sf.CoeffPrec, sf.CoeffShift = 12, 10
+			sf.Coeffs = []int32{1900, -1400, 700, -250}
+			sf.RiceSubframe = rice(sf, 3, 10)
+		},
+		"rice2": func(sf *frame.Subframe) {
+			sf.Pred, sf.Order = frame.PredFixed, 1
+			sf.ResidualCodingMethod = frame.ResidualCodingMethodRice2
+			sf.RiceSubframe = rice(sf, 1, 17)
+		},
+		"escaped": func(sf *frame.Subframe) {
+			sf.Pred, sf.Order = frame.PredFixed, 1
+			sf.RiceSubframe = rice(sf, 0, 15)
+			sf.RiceSubframe.Partitions[0].EscapedBitsPerSample = 20
+		},
+		"wasted": func(sf *frame.Subframe) {
+			sf.Pred, sf.Wasted = frame.PredVerbatim, 3
+		},
+	}
+	for _, tt := range []struct {
+		coding   string
+		depth    int
+		channels frame.Channels
+	}{
+		{"verbatim", 16, frame.ChannelsMono},
+		{"verbatim", 8, frame.ChannelsLR},
+		{"verbatim", 24, frame.ChannelsMono},
+		{"fixed", 16, frame.ChannelsLeftSide},
+		{"fixed", 16, frame.ChannelsSideRight},
+		{"lpc", 16, frame.ChannelsMidSide},
+		{"lpc", 24, frame.ChannelsLR},
+		{"rice2", 16, frame.ChannelsLR},
+		{"escaped", 16, frame.ChannelsMono},
+		{"wasted", 16, frame.ChannelsLR},
+	} {
+		name := tt.coding
+		n := tt.channels.Count()
+		// Frames of different sizes, the last one short.
+		sizes := []int{4096, 1152, 333}
+		var want [][]int32
+		var buf bytes.Buffer
+		enc, err := flac.NewEncoder(&buf, &meta.StreamInfo{
+			BlockSizeMin: 16, BlockSizeMax: 4096,
+			SampleRate: 32000, NChannels: uint8(n), BitsPerSample: uint8(tt.depth),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc.EnablePredictionAnalysis(false)
+		amp := float64(int(1)<<(tt.depth-1)) * 0.7
+		pos := 0
+		for _, size := range sizes {
+			f := &frame.Frame{Header: frame.Header{
+				BlockSize: uint16(size), SampleRate: 32000,
+				Channels: tt.channels, BitsPerSample: uint8(tt.depth),
+			}}
+			for c := range n {
+				x := make([]int32, size)
+				for i := range x {
+					v := amp * math.Sin(float64(pos+i)*0.03*float64(c+1))
+					x[i] = int32(v) + int32(rng.IntN(9)) - 4
+					if tt.coding == "wasted" {
+						x[i] &^= 7
+					}
+				}
+				sf := &frame.Subframe{Samples: x, NSamples: size}
+				codings[tt.coding](sf)
+				f.Subframes = append(f.Subframes, sf)
+				if len(want) <= c {
+					want = append(want, nil)
+				}
+				want[c] = append(want[c], x...)
+			}
+			if err := enc.WriteFrame(f); err != nil {
+				t.Fatalf("%s, %d bits: %v", name, tt.depth, err)
+			}
+			pos += size
+		}
+
+		buf2, err := decodeFLAC(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s, %d bits, channels %v: %v", name, tt.depth, tt.channels, err)
+		}
+		if buf2.Channels != n || buf2.Frames() != pos {
+			t.Fatalf("%s, %d bits: decoded %d frames of %d channels, want %d of %d", name, tt.depth, buf2.Frames(), buf2.Channels, pos, n)
+		}
+		scale := float32(uint64(1) << (tt.depth - 1))
+		for i := range pos {
+			for c := range n {
+				if got := buf2.Samples[i*n+c] * scale; got != float32(want[c][i]) {
+					t.Fatalf("%s, %d bits, channels %v: sample %d of channel %d is %v, want %d",
+						name, tt.depth, tt.channels, i, c, got, want[c][i])
+				}
+			}
+		}
+	}
+}
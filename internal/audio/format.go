@@ -0,0 +1,71 @@
+package audio
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Encoding is how samples are stored in a raw audio byte stream.
+type Encoding int
+
+const (
+	// PCM16 is signed 16-bit little-endian linear PCM.
+	PCM16 Encoding = iota
+	// MuLaw is 8-bit G.711 µ-law.
+	MuLaw
+	// ALaw is 8-bit G.711 A-law.
+	ALaw
+)
+
+// bytesPerSample returns the size of one encoded sample.
+func (e Encoding) bytesPerSample() int {
+	if e == PCM16 {
+		return 2
+	}
+	return 1
+}
+
+var encodingNames = map[string]Encoding{
+	"pcm":  PCM16,
+	"ulaw": MuLaw,
+	"alaw": ALaw,
+}
+
+// Format describes raw audio: its sample rate, channel count and encoding.
+type Format struct {
+	SampleRate int
+	Channels   int
+	Encoding   Encoding
+}
+
+// ParseFormat parses an ElevenLabs output format for raw audio, such as
+// "pcm_22050", "ulaw_8000" or "alaw_8000". MP3 and other compressed formats
+// are not raw audio and are rejected. The API only returns mono audio.
+func ParseFormat(name string) (Format, error) {
+	codec, rate, ok := strings.Cut(name, "_")
+	enc, known := encodingNames[codec]
+	if !ok || !known {
+		return Format{}, fmt.Errorf("%q is not a raw audio format (expected pcm_<rate>, ulaw_<rate> or alaw_<rate>)", name)
+	}
+	sampleRate, err := strconv.Atoi(rate)
+	if err != nil || sampleRate <= 0 {
+		return Format{}, fmt.Errorf("invalid sample rate in format %q", name)
+	}
+	return Format{SampleRate: sampleRate, Channels: 1, Encoding: enc}, nil
+}
+
+// String returns the ElevenLabs output format name of a mono format.
+func (f Format) String() string {
+	for name, enc := range encodingNames {
+		if enc == f.Encoding {
+			return fmt.Sprintf("%s_%d", name, f.SampleRate)
+		}
+	}
+	return fmt.Sprintf("unknown_%d", f.SampleRate)
+}
+
+// frameSize returns the number of bytes in one frame of f.
+func (f Format) frameSize() int {
+	return f.Encoding.bytesPerSample() * f.Channels
+}
@@ -0,0 +1,73 @@
+package audio
+
+// G.711 companding as used by the ulaw_8000 and alaw_8000 output formats.
+
+// ulawToLinear expands a µ-law byte to a 16-bit sample.
+func ulawToLinear(u byte) int16 {
+	u = ^u
+	t := (int(u&0x0F)<<3 + 0x84) << ((u & 0x70) >> 4)
+	if u&0x80 != 0 {
+		return int16(0x84 - t)
+	}
+	return int16(t - 0x84)
+}
+
+// linearToULaw compresses a 16-bit sample to µ-law.
+func linearToULaw(sample int16) byte {
+	const bias, clip = 0x84, 32635
+	s := int(sample)
+	sign := 0
+	if s < 0 {
+		s = -s
+		sign = 0x80
+	}
+	if s > clip {
+		s = clip
+	}
+	s += bias
+	exponent := 7
+	for mask := 0x4000; s&mask == 0 && exponent > 0; mask >>= 1 {
+		exponent--
+	}
+	mantissa := (s >> (exponent + 3)) & 0x0F
+	return ^byte(sign | exponent<<4 | mantissa)
+}
+
+// alawToLinear expands an A-law byte to a 16-bit sample.
+func alawToLinear(a byte) int16 {
+	a ^= 0x55
+	t := int(a&0x0F) << 4
+	switch seg := int(a&0x70) >> 4; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t = (t + 0x108) << (seg - 1)
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+// linearToALaw compresses a 16-bit sample to A-law.
+func linearToALaw(sample int16) byte {
+	s := int(sample) >> 3 // A-law works on 13-bit magnitudes
+	sign := 0x80
+	if s < 0 {
+		s = -s - 1
+		sign = 0
+	}
+	var out int
+	if s < 32 {
+		out = s >> 1
+	} else {
+		exponent := 1
+		for v := s >> 5; v > 1; v >>= 1 {
+			exponent++
+		}
+		out = exponent<<4 | (s>>exponent)&0x0F
+	}
+	return byte((sign | out) ^ 0x55)
+}
@@ -0,0 +1,150 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf16"
+)
+
+// ID3Tag is the metadata written in front of an MP3 stream as an ID3v2.3
+// tag, the version players support most widely. Empty fields are left out.
+type ID3Tag struct {
+	Title    string
+	Album    string
+	Artist   string
+	Composer string
+	Year     string
+	Genre    string
+	// Cover is a JPEG or PNG image stored as the front cover.
+	Cover []byte
+	// Chapters are written as CHAP frames listed in order by a top-level
+	// CTOC frame, so players can jump between them.
+	Chapters []ID3Chapter
+}
+
+// ID3Chapter is a titled range of an MP3 stream.
+type ID3Chapter struct {
+	Title      string
+	Start, End time.Duration
+}
+
+// id3MaxSize is the largest tag size the 28-bit size field can hold.
+const id3MaxSize = 1<<28 - 1
+
+// MaxID3Chapters is the most chapters a single CTOC frame can list.
+const MaxID3Chapters = 255
+
+// EncodeID3 returns t as an ID3v2.3 tag.
+func EncodeID3(t *ID3Tag) ([]byte, error) {
+	if len(t.Chapters) > MaxID3Chapters {
+		return nil, fmt.Errorf("%d chapters exceed the ID3 limit of %d", len(t.Chapters), MaxID3Chapters)
+	}
+
+	var body bytes.Buffer
+	for _, f := range []struct{ id, text string }{
+		{"TIT2", t.Title},
+		{"TALB", t.Album},
+		{"TPE1", t.Artist},
+		{"TCOM", t.Composer},
+		{"TYER", t.Year},
+		{"TCON", t.Genre},
+	} {
+		if f.text != "" {
+			writeID3Frame(&body, f.id, id3Text(f.text))
+		}
+	}
+
+	if len(t.Cover) > 0 {
+		mime, err := CoverMIME(t.Cover)
+		if err != nil {
+			return nil, fmt.Errorf("cover: %w", err)
+		}
+		var apic bytes.Buffer
+		apic.WriteByte(0) // ISO-8859-1 description
+		apic.WriteString(mime)
+		apic.WriteByte(0)
+		apic.WriteByte(3) // front cover
+		apic.WriteByte(0) // empty description
+		apic.Write(t.Cover)
+		writeID3Frame(&body, "APIC", apic.Bytes())
+	}
+
+	if len(t.Chapters) > 0 {
+		var toc bytes.Buffer
+		toc.WriteString("toc\x00")
+		toc.WriteByte(0x03) // top-level and ordered
+		toc.WriteByte(byte(len(t.Chapters)))
+		for i, c := range t.Chapters {
+			id := fmt.Sprintf("ch%d", i+1)
+			toc.WriteString(id + "\x00")
+
+			var chap bytes.Buffer
+			chap.WriteString(id + "\x00")
+			binary.Write(&chap, binary.BigEndian, [4]uint32{
+				uint32(c.Start.Milliseconds()),
+				uint32(c.End.Milliseconds()),
+				// Byte offsets are unknown until the stream is encoded.
+				0xffffffff,
+				0xffffffff,
+			})
+			if c.Title != "" {
+				writeID3Frame(&chap, "TIT2", id3Text(c.Title))
+			}
+			writeID3Frame(&body, "CHAP", chap.Bytes())
+		}
+		writeID3Frame(&body, "CTOC", toc.Bytes())
+	}
+
+	if body.Len() > id3MaxSize {
+		return nil, errors.New("ID3 tag exceeds 256 MiB; use a smaller cover image")
+	}
+	size := body.Len()
+	header := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(header, body.Bytes()...), nil
+}
+
+// writeID3Frame appends an ID3v2.3 frame, whose size, unlike the tag's, is a
+// plain 32-bit number.
+func writeID3Frame(w *bytes.Buffer, id string, data []byte) {
+	w.WriteString(id)
+	binary.Write(w, binary.BigEndian, uint32(len(data)))
+	w.Write([]byte{0, 0}) // flags
+	w.Write(data)
+}
+
+// id3Text encodes the body of a text frame: ISO-8859-1 when s fits, else
+// UTF-16 with a byte order mark, as ID3v2.3 has no UTF-8.
+func id3Text(s string) []byte {
+	latin := []byte{0}
+	for _, r := range s {
+		if r > 0xff {
+			latin = nil
+			break
+		}
+		latin = append(latin, byte(r))
+	}
+	if latin != nil {
+		return latin
+	}
+	out := []byte{1, 0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = binary.LittleEndian.AppendUint16(out, u)
+	}
+	return out
+}
+
+// CoverMIME returns the MIME type of a cover image, which must be a JPEG or
+// PNG file.
+func CoverMIME(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8, 0xff}):
+		return "image/jpeg", nil
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png", nil
+	}
+	return "", errors.New("not a JPEG or PNG image")
+}
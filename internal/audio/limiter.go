@@ -0,0 +1,137 @@
+package audio
+
+import "math"
+
+// Limiter keeps a mix under a ceiling by turning it down smoothly around
+// peaks, instead of clamping the samples that overflow. It looks Lookahead
+// samples ahead, so the gain has already fallen by the time a peak arrives,
+// and delays the audio by the same amount.
+type Limiter struct {
+	// Ceiling is the highest sample level let through, in dBFS.
+	Ceiling float64
+	// Lookahead is the number of samples over which the gain falls ahead
+	// of a peak.
+	Lookahead int
+	// Release is the time constant, in samples, with which the gain
+	// recovers after a peak.
+	Release int
+}
+
+// limiterLookahead and limiterRelease are the timings of NewLimiter in
+// seconds: short enough to catch single transients, long enough that the
+// gain changes do not distort.
+const (
+	limiterLookahead = 0.005
+	limiterRelease   = 0.05
+)
+
+// NewLimiter returns a Limiter with the given ceiling in dBFS and default
+// timings for audio at sampleRate.
+func NewLimiter(ceiling float64, sampleRate int) *Limiter {
+	return &Limiter{
+		Ceiling:   ceiling,
+		Lookahead: Samples(limiterLookahead, sampleRate),
+		Release:   Samples(limiterRelease, sampleRate),
+	}
+}
+
+// ceilingLevel returns the ceiling as a sample value of 16-bit PCM.
+func (l *Limiter) ceilingLevel() float64 {
+	return min(32768*DBToGain(l.Ceiling), 32767)
+}
+
+// limiter runs a Limiter over a stream of interleaved frames.
+//
+// Each frame needs a gain of at most ceiling/peak. The gain applied to the
+// frame leaving the delay line is the average, over the Lookahead+1 frames
+// up to the newest, of the smallest gain needed within Lookahead+1 frames
+// before each; every term of that average covers the outgoing frame, so it
+// never exceeds the gain that frame needs, and the averaging turns the
+// steps into ramps.
+type limiter struct {
+	ceiling float64
+	ch      int
+	// size is Lookahead+1, the length of both windows.
+	size  int
+	decay float64
+	// t is the number of frames processed.
+	t int
+
+	// delay holds the last Lookahead frames.
+	delay []float32
+	// minima is a monotonic queue of the frames in the minimum window:
+	// their gains increase from front to back.
+	minima []limiterGain
+	// held is the minimum after release; ring holds its last size values
+	// and sum their total.
+	held float64
+	ring []float64
+	sum  float64
+}
+
+type limiterGain struct {
+	t    int
+	gain float64
+}
+
+func newLimiter(l *Limiter, channels int) *limiter {
+	size := max(l.Lookahead, 0) + 1
+	s := &limiter{
+		ceiling: l.ceilingLevel(),
+		ch:      channels,
+		size:    size,
+		decay:   math.Exp(-1 / float64(max(l.Release, 1))),
+		delay:   make([]float32, (size-1)*channels),
+		minima:  make([]limiterGain, 0, size),
+		held:    1,
+		ring:    make([]float64, size),
+		sum:     float64(size),
+	}
+	for i := range s.ring {
+		s.ring[i] = 1
+	}
+	return s
+}
+
+// process limits frames in place. The result is delayed by Lookahead
+// frames: it starts with the end of the previous call, or with silence.
+func (s *limiter) process(frames []float32) {
+	for f := 0; f+s.ch <= len(frames); f += s.ch {
+		frame := frames[f : f+s.ch]
+		peak := 0.0
+		for _, v := range frame {
+			peak = max(peak, math.Abs(float64(v)))
+		}
+		gain := 1.0
+		if peak > s.ceiling {
+			gain = s.ceiling / peak
+		}
+
+		// Slide the minimum window on to this frame.
+		for len(s.minima) > 0 && s.minima[len(s.minima)-1].gain >= gain {
+			s.minima = s.minima[:len(s.minima)-1]
+		}
+		s.minima = append(s.minima, limiterGain{s.t, gain})
+		if s.minima[0].t <= s.t-s.size {
+			s.minima = s.minima[1:]
+		}
+		s.held = min(s.minima[0].gain, 1-(1-s.held)*s.decay)
+
+		slot := s.t % s.size
+		s.sum += s.held - s.ring[slot]
+		s.ring[slot] = s.held
+		g := float32(min(s.sum/float64(s.size), 1))
+
+		// Swap the frame with the one leaving the delay line.
+		if s.size > 1 {
+			slot = s.t % (s.size - 1) * s.ch
+			for c, v := range frame {
+				frame[c], s.delay[slot+c] = s.delay[slot+c], v
+			}
+		}
+		for c := range frame {
+			frame[c] *= g
+		}
+		s.t++
+	}
+}
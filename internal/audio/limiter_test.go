@@ -0,0 +1,62 @@
+package audio
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestLimiterCeiling(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		channels int
+		dither   bool
+	}{
+		{"mono", 1, false},
+		{"stereo", 2, false},
+		{"dither", 2, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rate := 44100
+			lim := NewLimiter(-1, rate)
+			tl := &Timeline{SampleRate: rate, Channels: tt.channels, Limiter: lim, Dither: tt.dither}
+			// Two near full-scale tones overlap for half a second, peaking
+			// about 6 dB over full scale, with a sharp transient at 0.5 s.
+			tl.Add(Clip{Source: bytes.NewReader(tone(rate, 1, rate, 440, -0.5))})
+			tl.Add(Clip{Start: rate / 2, Source: bytes.NewReader(tone(rate, 1, rate/2, 440, -0.5))})
+			pcm, err := tl.Render()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pcm) != rate*tt.channels*2 {
+				t.Fatalf("rendered %d bytes, want %d", len(pcm), rate*tt.channels*2)
+			}
+			ceiling := int(math.Round(lim.ceilingLevel()))
+			if p := peak(pcm); p > ceiling {
+				t.Errorf("peak %d exceeds the ceiling %d", p, ceiling)
+			}
+			// The limiter turns the overlap down to the ceiling, not below.
+			overlap := pcm[len(pcm)*3/4:]
+			if p := peak(overlap); float64(p) < float64(ceiling)*DBToGain(-0.5) {
+				t.Errorf("overlap peaks at %d, want close to the ceiling %d", p, ceiling)
+			}
+		})
+	}
+}
+
+func TestLimiterPassesQuietAudio(t *testing.T) {
+	rate := 44100
+	src := tone(rate, 1, rate/2, 440, -6)
+	render := func(l *Limiter) []byte {
+		tl := &Timeline{SampleRate: rate, Limiter: l}
+		tl.Add(Clip{Source: bytes.NewReader(src)})
+		pcm, err := tl.Render()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pcm
+	}
+	if !bytes.Equal(render(NewLimiter(-1, rate)), render(nil)) {
+		t.Error("limiter changed audio below its ceiling")
+	}
+}
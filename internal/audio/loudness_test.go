@@ -0,0 +1,58 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMeasureLoudnessReference(t *testing.T) {
+	// BS.1770-4: a 997 Hz sine at -20 dBFS in both channels of a stereo
+	// signal reads -20 LUFS. The K-weighting filter has about +0.69 dB of
+	// gain at 997 Hz, which the -0.691 dB offset cancels.
+	for _, rate := range []int{44100, 48000} {
+		l := MeasureLoudness(tone(rate, 2, 10*rate, 997, -20), rate, 2)
+		if math.Abs(l.Integrated+20) > 0.05 {
+			t.Errorf("%d Hz: integrated loudness %.3f LUFS, want -20", rate, l.Integrated)
+		}
+		if math.Abs(l.TruePeak+20) > 0.1 {
+			t.Errorf("%d Hz: true peak %.3f dBTP, want -20", rate, l.TruePeak)
+		}
+	}
+}
+
+func TestMeasureLoudnessMono(t *testing.T) {
+	// One channel carries half the power of the same signal in two.
+	l := MeasureLoudness(tone(48000, 1, 5*48000, 997, -20), 48000, 1)
+	if want := -20 - 10*math.Log10(2); math.Abs(l.Integrated-want) > 0.05 {
+		t.Errorf("integrated loudness %.3f LUFS, want %.3f", l.Integrated, want)
+	}
+}
+
+func TestMeasureLoudnessGating(t *testing.T) {
+	// Silence is below the absolute gate and does not dilute the reading,
+	// which would otherwise fall by 3 dB; only the few blocks straddling
+	// the end of the tone pull it down slightly.
+	rate := 48000
+	pcm := append(tone(rate, 2, 5*rate, 997, -20), make([]byte, 5*rate*4)...)
+	if l := MeasureLoudness(pcm, rate, 2); math.Abs(l.Integrated+20) > 0.2 {
+		t.Errorf("integrated loudness %.3f LUFS, want -20", l.Integrated)
+	}
+	if l := MeasureLoudness(make([]byte, rate*4), rate, 2); !math.IsInf(l.Integrated, -1) || !math.IsInf(l.TruePeak, -1) {
+		t.Errorf("silence measured %v, want -Inf", l)
+	}
+}
+
+func TestLoudnessMeterSplitWrites(t *testing.T) {
+	pcm := tone(44100, 2, 3*44100, 440, -12)
+	want := MeasureLoudness(pcm, 44100, 2)
+
+	m := NewLoudnessMeter(44100, 2)
+	for p := pcm; len(p) > 0; {
+		n := min(1001, len(p))
+		m.Write(p[:n])
+		p = p[n:]
+	}
+	if got := m.Loudness(); got != want {
+		t.Errorf("split writes measured %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,339 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/braheezy/shine-mp3/pkg/mp3"
+	mp3dec "github.com/hajimehoshi/go-mp3"
+)
+
+// DefaultMP3Bitrate is the bitrate in kbps MP3s are encoded at unless told
+// otherwise.
+const DefaultMP3Bitrate = 128
+
+// mp3Bitrates are the Layer III bitrates in kbps of MPEG-1, used at 32, 44.1
+// and 48 kHz, and of MPEG-2, used at 16, 22.05 and 24 kHz, in the order of
+// their frame header index starting at 1. The encoder also accepts the
+// MPEG-2.5 rates (8, 11.025 and 12 kHz) but common decoders reject them.
+var mp3Bitrates = map[int][]int{
+	1: {32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	2: {8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// mp3Version returns the MPEG version, 1 or 2, that encodes sampleRate, or 0
+// if the encoder does not support it.
+func mp3Version(sampleRate int) int {
+	switch sampleRate {
+	case 32000, 44100, 48000:
+		return 1
+	case 16000, 22050, 24000:
+		return 2
+	}
+	return 0
+}
+
+// mp3SlotsPerFrame returns the average size in bytes of an MP3 frame as a
+// whole number of bytes and a fraction. It uses integer arithmetic: the
+// encoder's own floating-point formula gives e.g. 431.999... instead of 432
+// at 96 kbps and 32 kHz, which makes it set the padding bit on frames it
+// does not pad.
+func mp3SlotsPerFrame(sampleRate, bitrate int) (whole int, frac float64) {
+	granules := 3 - mp3Version(sampleRate) // 2 for MPEG-1, 1 for MPEG-2
+	bits := granules * mp3.GRANULE_SIZE * bitrate * 1000 / 8
+	return bits / sampleRate, float64(bits%sampleRate) / float64(sampleRate)
+}
+
+// mp3GranuleBits returns the most bits the encoder may spend on one channel
+// of one granule. The granule length field has 12 bits; frames that need more
+// come out corrupt.
+func mp3GranuleBits(sampleRate, channels, bitrate int) int {
+	v := mp3Version(sampleRate)
+	granules := 3 - v
+	sideInfo := map[int][2]int{1: {17, 32}, 2: {9, 17}}[v][channels-1]
+	// Frames are padded with one extra byte where the bitrate does not
+	// divide evenly, so allow for that.
+	whole, _ := mp3SlotsPerFrame(sampleRate, bitrate)
+	bits := (whole + 1) * 8
+	return (bits - (4+sideInfo)*8) / granules / channels
+}
+
+// MP3Mode is the channel mode of an MP3 stream. The encoder has no joint
+// stereo: it always codes the two channels separately.
+type MP3Mode int
+
+const (
+	// MP3Auto encodes mono input as mono and stereo input as stereo.
+	MP3Auto MP3Mode = iota
+	// MP3Stereo encodes two channels that form one stereo image; mono
+	// input is copied to both.
+	MP3Stereo
+	// MP3DualChannel encodes two independent channels, such as two
+	// languages; mono input is copied to both.
+	MP3DualChannel
+	// MP3Mono encodes one channel; stereo input is mixed down.
+	MP3Mono
+)
+
+// mp3Modes are the names ParseMP3Mode accepts.
+var mp3Modes = map[string]MP3Mode{
+	"stereo":       MP3Stereo,
+	"dual-channel": MP3DualChannel,
+	"mono":         MP3Mono,
+}
+
+// ParseMP3Mode returns the mode named s: "stereo", "dual-channel" or "mono".
+func ParseMP3Mode(s string) (MP3Mode, error) {
+	m, ok := mp3Modes[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown MP3 mode %q (supported: stereo, dual-channel or mono)", s)
+	}
+	return m, nil
+}
+
+// channels returns the number of channels m encodes for input with the
+// given channel count.
+func (m MP3Mode) channels(input int) int {
+	switch m {
+	case MP3Stereo, MP3DualChannel:
+		return 2
+	case MP3Mono:
+		return 1
+	}
+	return input
+}
+
+// CheckMP3 reports whether the encoder produces valid MP3 in mode for PCM
+// with the given sample rate and channel count at bitrate kbps.
+func CheckMP3(sampleRate, channels, bitrate int, mode MP3Mode) error {
+	if channels != 1 && channels != 2 {
+		return fmt.Errorf("unsupported channel count %d", channels)
+	}
+	channels = mode.channels(channels)
+	v := mp3Version(sampleRate)
+	if v == 0 {
+		return fmt.Errorf("unsupported sample rate %d (supported: 16000, 22050, 24000, 32000, 44100 or 48000)", sampleRate)
+	}
+	if !slices.Contains(mp3Bitrates[v], bitrate) {
+		valid := make([]string, len(mp3Bitrates[v]))
+		for i, b := range mp3Bitrates[v] {
+			valid[i] = strconv.Itoa(b)
+		}
+		return fmt.Errorf("bitrate %d kbps is not valid at %d Hz (valid: %s)", bitrate, sampleRate, strings.Join(valid, ", "))
+	}
+	if mp3GranuleBits(sampleRate, channels, bitrate) > 4095 {
+		highest := 0
+		for _, b := range mp3Bitrates[v] {
+			if mp3GranuleBits(sampleRate, channels, b) <= 4095 {
+				highest = b
+			}
+		}
+		return fmt.Errorf("bitrate %d kbps is too high for %d-channel audio at %d Hz (at most %d)", bitrate, channels, sampleRate, highest)
+	}
+	return nil
+}
+
+// EncodeMP3 encodes 16-bit PCM data at the given sample rate to MP3 at
+// bitrate kbps in mode. Stereo input has its two channels interleaved. The
+// input is zero-padded to a whole number of MP3 frames.
+func EncodeMP3(pcm []byte, sampleRate, channels, bitrate int, mode MP3Mode) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := NewMP3Writer(&buf, sampleRate, channels, bitrate, mode)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(pcm); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MP3Writer encodes 16-bit PCM written to it as MP3, passing each frame to
+// the underlying writer as soon as it is complete. It holds no more than one
+// frame of audio, so arbitrarily long input streams in constant memory.
+type MP3Writer struct {
+	w       *byteCounter
+	encoder *mp3.Encoder
+	// frameBytes is the total size of the frames encoded so far. The
+	// encoder holds back the last few bytes of each frame until it writes
+	// the next one, so w falls short of it.
+	frameBytes int
+	// frame holds the input samples of the frame being filled.
+	frame []int16
+	size  int // input samples per frame across all channels
+	n     int // samples in frame
+	// in and out are the channel counts of the input and of the stream.
+	in, out int
+	// encoded holds a frame as passed to the encoder, followed by a spare
+	// frame: the encoder keeps a pointer just past the last sample it read,
+	// and the spare frame keeps that pointer inside the allocation, where
+	// the garbage collector expects it.
+	encoded []int16
+	// odd holds the first byte of a sample split between two writes.
+	odd    byte
+	hasOdd bool
+	err    error
+}
+
+// NewMP3Writer returns an MP3Writer that writes MP3 at bitrate kbps in mode
+// to w. Input is 16-bit PCM at sampleRate with channels interleaved channels.
+func NewMP3Writer(w io.Writer, sampleRate, channels, bitrate int, mode MP3Mode) (*MP3Writer, error) {
+	if err := CheckMP3(sampleRate, channels, bitrate, mode); err != nil {
+		return nil, fmt.Errorf("MP3 encoding failed: %w", err)
+	}
+	out := mode.channels(channels)
+	encoder := mp3.NewEncoder(sampleRate, out)
+	setMP3Bitrate(encoder, sampleRate, bitrate)
+	if mode == MP3DualChannel {
+		encoder.Mpeg.Mode = mp3.DUAL_CHANNEL
+	}
+
+	// The encoder consumes exactly one frame per call and reads past the end
+	// of a short slice, so it is only ever fed full frames.
+	frame := int(encoder.Mpeg.GranulesPerFrame) * mp3.GRANULE_SIZE
+	return &MP3Writer{
+		w:       &byteCounter{w: w},
+		encoder: encoder,
+		frame:   make([]int16, frame*channels),
+		size:    frame * channels,
+		in:      channels,
+		out:     out,
+		encoded: make([]int16, 2*frame*out),
+	}, nil
+}
+
+// setMP3Bitrate changes the bitrate of a new encoder, which always starts
+// out at 128 kbps, and recomputes its frame size. shine-mp3 offers no way
+// to choose the bitrate, so this sets fields of its Encoder.Mpeg directly;
+// go.mod pins the version these fields were checked against.
+func setMP3Bitrate(encoder *mp3.Encoder, sampleRate, bitrate int) {
+	m := &encoder.Mpeg
+	m.Bitrate = int64(bitrate)
+	m.BitrateIndex = int64(slices.Index(mp3Bitrates[mp3Version(sampleRate)], bitrate) + 1)
+	whole, frac := mp3SlotsPerFrame(sampleRate, bitrate)
+	m.WholeSlotsPerFrame = int64(whole)
+	m.FracSlotsPerFrame = frac
+	m.Slot_lag = -m.FracSlotsPerFrame
+	if m.FracSlotsPerFrame == 0 {
+		m.Padding = 0
+	}
+}
+
+// Write encodes p, which may end in the middle of a sample or frame; the
+// remainder is kept for the next call.
+func (w *MP3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := len(p)
+	if w.hasOdd && len(p) > 0 {
+		w.push(int16(uint16(w.odd) | uint16(p[0])<<8))
+		p = p[1:]
+		w.hasOdd = false
+	}
+	for len(p) >= 2 && w.err == nil {
+		k := min(w.size-w.n, len(p)/2)
+		for i := range k {
+			w.frame[w.n+i] = int16(binary.LittleEndian.Uint16(p[i*2:]))
+		}
+		w.n += k
+		p = p[k*2:]
+		if w.n == w.size {
+			w.flush()
+		}
+	}
+	if len(p) == 1 {
+		w.odd, w.hasOdd = p[0], true
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return written, nil
+}
+
+// push appends one sample, encoding the frame once it is full.
+func (w *MP3Writer) push(v int16) {
+	w.frame[w.n] = v
+	w.n++
+	if w.n == w.size {
+		w.flush()
+	}
+}
+
+func (w *MP3Writer) flush() {
+	frame := w.size / w.in
+	enc := w.encoded[:frame*w.out]
+	switch {
+	case w.in == w.out:
+		copy(enc, w.frame)
+	case w.in == 1:
+		for i, v := range w.frame {
+			enc[2*i], enc[2*i+1] = v, v
+		}
+	default:
+		for i := range enc {
+			enc[i] = int16((int32(w.frame[2*i]) + int32(w.frame[2*i+1])) / 2)
+		}
+	}
+	if err := w.encoder.Write(w.w, enc); err != nil {
+		w.err = fmt.Errorf("MP3 encoding failed: %w", err)
+	}
+	w.frameBytes += int(w.encoder.Mpeg.BitsPerFrame / 8)
+	w.n = 0
+}
+
+// Close zero-pads and encodes the last partial frame, and writes out the
+// bytes the encoder still holds. It does not close the underlying writer.
+func (w *MP3Writer) Close() error {
+	if w.err == nil && w.n > 0 {
+		clear(w.frame[w.n:w.size])
+		w.flush()
+	}
+	if held := w.frameBytes - w.w.n; w.err == nil && held > 0 {
+		// The encoder has no flush: the held bytes come out at the start
+		// of the next frame, so encode a silent one and keep only those.
+		enc := w.encoded[:w.size/w.in*w.out]
+		clear(enc)
+		var next bytes.Buffer
+		if err := w.encoder.Write(&next, enc); err != nil {
+			w.err = fmt.Errorf("MP3 encoding failed: %w", err)
+		} else if _, err := w.w.Write(next.Bytes()[:held]); err != nil {
+			w.err = fmt.Errorf("MP3 encoding failed: %w", err)
+		}
+	}
+	return w.err
+}
+
+// byteCounter passes writes through to w, counting the bytes written.
+type byteCounter struct {
+	w io.Writer
+	n int
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+// decodeMP3 decodes an MP3 file into a Buffer. The decoder always produces
+// stereo, so a mono file comes out with two identical channels.
+func decodeMP3(data []byte) (*Buffer, error) {
+	d, err := mp3dec.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	pcm, err := io.ReadAll(d)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(pcm[:len(pcm)/4*4], Format{SampleRate: d.SampleRate(), Channels: 2, Encoding: PCM16})
+}
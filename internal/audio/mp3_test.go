@@ -0,0 +1,197 @@
+package audio
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	mp3dec "github.com/hajimehoshi/go-mp3"
+)
+
+// mp3Frame is the part of an MP3 frame header the tests check.
+type mp3Frame struct {
+	version, bitrate, sampleRate int
+	mode                         byte
+	size                         int
+}
+
+// parseMP3Frames splits an MP3 stream into frames by their headers. The
+// stream must end with a complete frame.
+func parseMP3Frames(t *testing.T, data []byte) []mp3Frame {
+	t.Helper()
+	rates := map[int][]int{1: {44100, 48000, 32000}, 2: {22050, 24000, 16000}}
+	var frames []mp3Frame
+	off := 0
+	for off < len(data) {
+		h := data[off:]
+		if len(h) < 4 || h[0] != 0xff || h[1]&0xe0 != 0xe0 || h[1]>>1&3 != 1 {
+			t.Fatalf("no Layer III frame header at byte %d", off)
+		}
+		f := mp3Frame{version: 2, mode: h[3] >> 6}
+		if h[1]>>3&3 == 3 {
+			f.version = 1
+		}
+		f.bitrate = mp3Bitrates[f.version][h[2]>>4-1]
+		f.sampleRate = rates[f.version][h[2]>>2&3]
+		f.size = 144000 * f.bitrate / f.sampleRate / f.version
+		if h[2]>>1&1 == 1 {
+			f.size++
+		}
+		frames = append(frames, f)
+		off += f.size
+	}
+	if off != len(data) {
+		t.Fatalf("last frame is %d bytes short", off-len(data))
+	}
+	return frames
+}
+
+func TestEncodeMP3Frames(t *testing.T) {
+	for _, rate := range []int{16000, 22050, 24000, 32000, 44100, 48000} {
+		for _, channels := range []int{1, 2} {
+			for _, bitrate := range mp3Bitrates[mp3Version(rate)] {
+				if CheckMP3(rate, channels, bitrate, MP3Auto) != nil {
+					continue
+				}
+				// 1.5 seconds, which does not end on a frame boundary.
+				frames := rate * 3 / 2
+				data, err := EncodeMP3(tone(rate, channels, frames, 440, -3), rate, channels, bitrate, MP3Auto)
+				if err != nil {
+					t.Fatalf("%d Hz, %d channels, %d kbps: %v", rate, channels, bitrate, err)
+				}
+				got := parseMP3Frames(t, data)
+
+				perFrame := 1152 / mp3Version(rate)
+				if want := (frames + perFrame - 1) / perFrame; len(got) != want {
+					t.Errorf("%d Hz, %d channels, %d kbps: %d frames, want %d", rate, channels, bitrate, len(got), want)
+				}
+				mode := byte(3) // mono
+				if channels == 2 {
+					mode = 0 // stereo
+				}
+				// setMP3Bitrate writes shine's internal encoder fields; if a
+				// new version of the library stops honouring them, frames
+				// come out at its default bitrate instead.
+				for i, f := range got {
+					if f.bitrate != bitrate || f.sampleRate != rate || f.mode != mode {
+						t.Fatalf("%d Hz, %d channels, %d kbps: frame %d is %d Hz, mode %d at %d kbps",
+							rate, channels, bitrate, i, f.sampleRate, f.mode, f.bitrate)
+					}
+				}
+				// Padding keeps the stream within a few bytes of the nominal
+				// bitrate, however long it runs.
+				seconds := float64(len(got)*perFrame) / float64(rate)
+				if want := float64(bitrate) * 1000 / 8 * seconds; math.Abs(float64(len(data))-want) > 4 {
+					t.Errorf("%d Hz, %d channels, %d kbps: %d bytes, want %.0f", rate, channels, bitrate, len(data), want)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeMP3Mode(t *testing.T) {
+	for _, tt := range []struct {
+		channels int
+		mode     MP3Mode
+		want     byte
+	}{
+		{1, MP3Auto, 3},
+		{2, MP3Auto, 0},
+		{1, MP3Stereo, 0},
+		{2, MP3Stereo, 0},
+		{1, MP3DualChannel, 2},
+		{2, MP3DualChannel, 2},
+		{1, MP3Mono, 3},
+		{2, MP3Mono, 3},
+	} {
+		data, err := EncodeMP3(tone(44100, tt.channels, 5000, 440, -6), 44100, tt.channels, 128, tt.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, f := range parseMP3Frames(t, data) {
+			if f.mode != tt.want {
+				t.Fatalf("%d channels in mode %d: frame %d has mode %d, want %d", tt.channels, tt.mode, i, f.mode, tt.want)
+			}
+		}
+	}
+}
+
+func TestParseMP3Mode(t *testing.T) {
+	for name, want := range map[string]MP3Mode{"stereo": MP3Stereo, "dual-channel": MP3DualChannel, "mono": MP3Mono} {
+		if got, err := ParseMP3Mode(name); err != nil || got != want {
+			t.Errorf("ParseMP3Mode(%q) = %d, %v; want %d", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"", "joint", "Stereo"} {
+		if _, err := ParseMP3Mode(name); err == nil {
+			t.Errorf("ParseMP3Mode(%q) succeeded", name)
+		}
+	}
+}
+
+func TestEncodeMP3Decodes(t *testing.T) {
+	for _, tt := range []struct {
+		rate, channels, bitrate int
+		mode                    MP3Mode
+	}{
+		{44100, 1, 64, MP3Auto},
+		{44100, 2, 192, MP3Auto},
+		{48000, 2, 128, MP3DualChannel},
+		{32000, 2, 96, MP3Mono},
+		{24000, 1, 64, MP3Stereo},
+		{16000, 1, 32, MP3Auto},
+	} {
+		frames := tt.rate * 2
+		data, err := EncodeMP3(tone(tt.rate, tt.channels, frames, 440, -6), tt.rate, tt.channels, tt.bitrate, tt.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := mp3dec.NewDecoder(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%+v: %v", tt, err)
+		}
+		pcm, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt, err)
+		}
+		// The decoder always produces stereo. The stream is padded to whole
+		// frames and decodes with a short delay, both under one frame.
+		got := len(pcm) / 4
+		if d.SampleRate() != tt.rate || got < frames || got > frames+1152 {
+			t.Errorf("%+v: decoded %d frames at %d Hz, want %d", tt, got, d.SampleRate(), frames)
+		}
+		// A -6 dBFS tone keeps its level through the codec, whatever the
+		// mode does with its channels.
+		if p := peak(pcm); p < 13000 || p > 19000 {
+			t.Errorf("%+v: decoded peak %d, want about 16400", tt, p)
+		}
+	}
+}
+
+func TestMP3WriterSplitWrites(t *testing.T) {
+	pcm := tone(44100, 2, 44100, 440, -3)
+	want, err := EncodeMP3(pcm, 44100, 2, 128, MP3Auto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := NewMP3Writer(&buf, 44100, 2, 128, MP3Auto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Odd sizes split samples as well as frames.
+	for p := pcm; len(p) > 0; {
+		n := min(1001, len(p))
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Error("split writes encoded differently")
+	}
+}
@@ -0,0 +1,106 @@
+package audio
+
+import "math"
+
+// The resampler is a band-limited windowed-sinc interpolator in the style of
+// Julius O. Smith's resample: every output sample is a weighted sum of the
+// input samples around its position, with the kernel stretched when
+// downsampling so it also acts as the anti-aliasing filter.
+const (
+	// resampleZeroCrossings is the number of sinc lobes on each side of the
+	// kernel; more lobes give a steeper transition band.
+	resampleZeroCrossings = 24
+	// resampleDensity is the number of kernel table entries per lobe.
+	resampleDensity = 512
+	// resampleBeta is the Kaiser window shape, giving about 80 dB of
+	// stopband attenuation.
+	resampleBeta = 8.0
+	// resampleRolloff places the cutoff just below the lower of the two
+	// Nyquist frequencies so the transition band does not alias.
+	resampleRolloff = 0.95
+)
+
+// resampleKernel tabulates the Kaiser-windowed sinc for x in
+// [0, resampleZeroCrossings] at resampleDensity points per unit.
+var resampleKernel = func() []float64 {
+	n := resampleZeroCrossings*resampleDensity + 1
+	table := make([]float64, n+1) // one extra zero for interpolation
+	norm := besselI0(resampleBeta)
+	for i := 0; i < n; i++ {
+		x := float64(i) / resampleDensity
+		sinc := 1.0
+		if i > 0 {
+			sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		r := x / resampleZeroCrossings
+		table[i] = sinc * besselI0(resampleBeta*math.Sqrt(1-r*r)) / norm
+	}
+	return table
+}()
+
+// kernel returns the windowed sinc at x by linear interpolation in the
+// table.
+func kernel(x float64) float64 {
+	pos := math.Abs(x) * resampleDensity
+	i := int(pos)
+	if i >= len(resampleKernel)-1 {
+		return 0
+	}
+	frac := pos - float64(i)
+	return resampleKernel[i] + frac*(resampleKernel[i+1]-resampleKernel[i])
+}
+
+// besselI0 is the zeroth-order modified Bessel function of the first kind,
+// used by the Kaiser window.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > 1e-12*sum; k++ {
+		half := x / (2 * float64(k))
+		term *= half * half
+		sum += term
+	}
+	return sum
+}
+
+// Resample returns b converted to sampleRate. The result has the same
+// duration as b, rounded to whole frames.
+func (b *Buffer) Resample(sampleRate int) *Buffer {
+	if sampleRate == b.SampleRate {
+		out := *b
+		out.Samples = append([]float32(nil), b.Samples...)
+		return &out
+	}
+
+	ratio := float64(sampleRate) / float64(b.SampleRate)
+	cutoff := resampleRolloff * math.Min(1, ratio)
+	half := resampleZeroCrossings / cutoff
+	frames := b.Frames()
+	ch := b.Channels
+
+	out := NewBuffer(sampleRate, ch, int(math.Round(float64(frames)*ratio)))
+	weights := make([]float64, 0, 2*int(half)+2)
+	sums := make([]float64, ch)
+	for n := 0; n < out.Frames(); n++ {
+		t := float64(n) / ratio
+		lo := max(int(math.Ceil(t-half)), 0)
+		hi := min(int(math.Floor(t+half)), frames-1)
+
+		weights = weights[:0]
+		for k := lo; k <= hi; k++ {
+			weights = append(weights, cutoff*kernel((t-float64(k))*cutoff))
+		}
+		for c := range sums {
+			sums[c] = 0
+		}
+		for j, w := range weights {
+			frame := b.Samples[(lo+j)*ch:]
+			for c := range sums {
+				sums[c] += float64(frame[c]) * w
+			}
+		}
+		for c, s := range sums {
+			out.Samples[n*ch+c] = float32(s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,63 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// level returns the amplitude of the freq Hz component of channel c of b,
+// by correlating it with a sine and cosine over its middle half, away from
+// the edges of the resampling kernel.
+func level(b *Buffer, c int, freq float64) float64 {
+	n := b.Frames()
+	var re, im float64
+	for i := n / 4; i < 3*n/4; i++ {
+		w := 2 * math.Pi * freq * float64(i) / float64(b.SampleRate)
+		v := float64(b.Samples[i*b.Channels+c])
+		re += v * math.Cos(w)
+		im += v * math.Sin(w)
+	}
+	return 2 * math.Hypot(re, im) / float64(n/2)
+}
+
+func TestResampleTone(t *testing.T) {
+	tests := []struct {
+		from, to int
+		freq     float64
+	}{
+		{44100, 16000, 1000},
+		{16000, 44100, 1000},
+		{22050, 48000, 5000},
+		{8000, 44100, 3000},
+		{48000, 44100, 10000},
+	}
+	for _, tt := range tests {
+		in, err := Decode(tone(tt.from, 2, tt.from, tt.freq, -6), Format{Encoding: PCM16, SampleRate: tt.from, Channels: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := in.Resample(tt.to)
+		if out.SampleRate != tt.to || out.Frames() != tt.to {
+			t.Errorf("%d -> %d Hz: got %d frames at %d Hz, want one second", tt.from, tt.to, out.Frames(), out.SampleRate)
+		}
+		want := DBToGain(-6)
+		for c := range 2 {
+			if got := level(out, c, tt.freq); math.Abs(db(got/want)) > 0.1 {
+				t.Errorf("%d -> %d Hz, channel %d: %g Hz tone at %.2f dB, want 0", tt.from, tt.to, c, tt.freq, db(got/want))
+			}
+		}
+	}
+}
+
+func TestResampleRejectsAliases(t *testing.T) {
+	// A 12 kHz tone cannot be represented at 16 kHz; it must be filtered
+	// out rather than fold down to 4 kHz.
+	in, err := Decode(tone(44100, 1, 44100, 12000, 0), Format{Encoding: PCM16, SampleRate: 44100, Channels: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := in.Resample(16000)
+	if alias := db(level(out, 0, 4000)); alias > -60 {
+		t.Errorf("alias at 4 kHz is %.1f dBFS, want below -60", alias)
+	}
+}
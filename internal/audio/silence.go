@@ -0,0 +1,62 @@
+package audio
+
+import "encoding/binary"
+
+const (
+	// silenceWindow is the length in seconds of the RMS windows used to tell
+	// sound from silence.
+	silenceWindow = 0.01
+	// silenceMargin is the audio in seconds kept before the first and after
+	// the last sound, so soft onsets and decays are not clipped.
+	silenceMargin = 0.02
+)
+
+// SoundBounds returns the range [start, end) of frames of 16-bit PCM with
+// the given number of interleaved channels that holds sound: everything
+// from the first to the last 10 ms window whose RMS level over all channels
+// exceeds thresholdDB dBFS, plus a short margin either side. PCM that is
+// silent throughout gives an empty range.
+func SoundBounds(pcm []byte, sampleRate, channels int, thresholdDB float64) (start, end int) {
+	n := len(pcm) / (2 * channels)
+	window := max(Samples(silenceWindow, sampleRate), 1)
+	// Compare mean squares with the squared threshold in 16-bit units.
+	threshold := DBToGain(thresholdDB) * 32768
+	threshold *= threshold
+
+	loud := func(w int) bool {
+		sum := 0.0
+		from, to := w*window*channels, min((w+1)*window, n)*channels
+		for i := from; i < to; i++ {
+			v := float64(int16(binary.LittleEndian.Uint16(pcm[i*2:])))
+			sum += v * v
+		}
+		return sum/float64(to-from) > threshold
+	}
+
+	windows := (n + window - 1) / window
+	first := 0
+	for first < windows && !loud(first) {
+		first++
+	}
+	if first == windows {
+		return 0, 0
+	}
+	last := windows - 1
+	for !loud(last) {
+		last--
+	}
+
+	margin := Samples(silenceMargin, sampleRate)
+	return max(first*window-margin, 0), min((last+1)*window+margin, n)
+}
+
+// TrimSilence returns 16-bit PCM with the given number of interleaved
+// channels without the silence before and after the sound found by
+// SoundBounds. PCM that is silent throughout is returned unchanged.
+func TrimSilence(pcm []byte, sampleRate, channels int, thresholdDB float64) []byte {
+	start, end := SoundBounds(pcm, sampleRate, channels, thresholdDB)
+	if start == end {
+		return pcm
+	}
+	return pcm[start*2*channels : end*2*channels]
+}
@@ -0,0 +1,506 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/rand/v2"
+)
+
+// Source is 16-bit PCM that is read as it is needed, such as a
+// *bytes.Reader over audio in memory or an *io.SectionReader over a file.
+// It is mono unless whoever hands it over says otherwise.
+type Source interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// Clip is a piece of PCM audio placed on a Timeline.
+type Clip struct {
+	// Start is the position of the clip's first sample on the timeline.
+	Start int
+	// Source is the clip's audio. It is only read while the timeline is
+	// rendered, a chunk at a time.
+	Source Source
+	// Channels is the number of interleaved channels of Source: 1 (mono,
+	// the default) or 2 (stereo).
+	Channels int
+	// Length, when positive, cuts the clip off after this many samples.
+	Length int
+	// GainDB changes the clip's level by this many decibels; 0 leaves it
+	// unchanged.
+	GainDB float64
+	// Fades ramp the clip's level at its start or end. Overlapping fades
+	// multiply; fade-outs end where the clip is cut off by Length.
+	Fades []Fade
+	// Key marks the clip as part of the sidechain that ducks other clips.
+	Key bool
+	// Duck, when non-nil, turns the clip down while key clips are audible.
+	Duck *Ducking
+	// Pan places the clip in a stereo timeline, from -1 (hard left) through
+	// 0 (centre) to 1 (hard right); on a stereo clip it is a balance
+	// control. It is ignored on mono timelines.
+	Pan float64
+}
+
+// Curve is the shape of a fade.
+type Curve int
+
+const (
+	// Linear ramps the amplitude in a straight line. Crossfading two
+	// correlated signals with it keeps their sum constant.
+	Linear Curve = iota
+	// EqualPower follows a quarter sine, keeping the combined power of two
+	// uncorrelated signals constant through a crossfade.
+	EqualPower
+)
+
+// gain returns the level of a fade-in at position t in [0, 1].
+func (c Curve) gain(t float64) float64 {
+	if c == EqualPower {
+		return math.Sin(t * math.Pi / 2)
+	}
+	return t
+}
+
+// Fade is a gain ramp from silence at the start of a clip, or to silence at
+// its end.
+type Fade struct {
+	// Out selects a fade-out instead of a fade-in.
+	Out     bool
+	Samples int
+	Curve   Curve
+}
+
+// channels returns the number of channels of the clip's Source.
+func (c Clip) channels() int {
+	return max(c.Channels, 1)
+}
+
+// Samples returns the number of samples the clip occupies on the timeline.
+func (c Clip) Samples() int {
+	n := int(c.Source.Size()) / (2 * c.channels())
+	if c.Length > 0 && c.Length < n {
+		return c.Length
+	}
+	return n
+}
+
+// level returns the gain applied to sample i of a clip n samples long.
+func (c Clip) level(i, n int, gain float64) float64 {
+	g := gain
+	for _, f := range c.Fades {
+		pos := i
+		if f.Out {
+			pos = n - 1 - i
+		}
+		if pos < f.Samples {
+			g *= f.Curve.gain(float64(pos) / float64(f.Samples))
+		}
+	}
+	return g
+}
+
+// panGains returns the gain of each of the channels output channels. A mono
+// clip uses the constant-power pan law, so a centred clip is 3 dB down in
+// each channel and its loudness does not change as it moves across. A
+// stereo clip is balanced instead: panning turns the far channel down and
+// leaves the near one alone.
+func (c Clip) panGains(channels int) []float64 {
+	if channels == 1 {
+		return []float64{1}
+	}
+	if c.channels() == 2 {
+		return []float64{min(1-c.Pan, 1), min(1+c.Pan, 1)}
+	}
+	angle := (c.Pan + 1) * math.Pi / 4
+	return []float64{math.Cos(angle), math.Sin(angle)}
+}
+
+// sample returns channel k of frame i of pcm, read from the clip, for a mix
+// with the given number of channels. A stereo clip is averaged into a mono
+// mix; a mono clip feeds every channel.
+func (c Clip) sample(pcm []byte, i, k, channels int) float64 {
+	at := func(j int) float64 {
+		return float64(int16(binary.LittleEndian.Uint16(pcm[j*2:])))
+	}
+	switch {
+	case c.channels() == 1:
+		return at(i)
+	case channels == 1:
+		return (at(i*2) + at(i*2+1)) / 2
+	}
+	return at(i*2 + k)
+}
+
+// End returns the timeline position just past the clip's last sample.
+func (c Clip) End() int {
+	return c.Start + c.Samples()
+}
+
+// read returns frames [from, to) of the clip's audio, reusing buf.
+func (c Clip) read(from, to int, buf []byte) ([]byte, error) {
+	size := 2 * c.channels()
+	buf = grow(buf, (to-from)*size)
+	n, err := c.Source.ReadAt(buf, int64(from*size))
+	if n == len(buf) {
+		return buf, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+// Timeline places clips at sample offsets and mixes them down. Clips may
+// overlap freely; overlapping samples are summed and then limited or
+// clamped, gaps are silent.
+type Timeline struct {
+	// SampleRate is the rate of every clip's PCM. Defaults to SampleRate.
+	SampleRate int
+	// Channels is the number of output channels: 1 (mono, the default) or
+	// 2 (stereo). Mono clips are placed by their Pan; stereo clips keep
+	// their channels in a stereo mix and are averaged into a mono one.
+	Channels int
+	// Limiter, when non-nil, keeps the mix under its ceiling. Without it,
+	// samples that overflow 16 bits are clamped.
+	Limiter *Limiter
+	// Dither keeps every clip's contribution at full precision and adds
+	// triangular dither when the mix is converted to 16 bits. Without it,
+	// each contribution is rounded to a whole sample value as it is added.
+	Dither bool
+
+	clips []Clip
+}
+
+// Add places a clip on the timeline.
+func (t *Timeline) Add(c Clip) {
+	t.clips = append(t.clips, c)
+}
+
+// Len returns the timeline length in samples: the end of the last clip.
+func (t *Timeline) Len() int {
+	n := 0
+	for _, c := range t.clips {
+		if e := c.End(); e > n {
+			n = e
+		}
+	}
+	return n
+}
+
+// renderChunk is the number of frames a Timeline mixes at a time.
+const renderChunk = 1 << 16
+
+// Render mixes all clips into a single PCM buffer of Len frames, with
+// Channels interleaved samples per frame.
+func (t *Timeline) Render() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(t.Len() * max(t.Channels, 1) * 2)
+	_, err := io.Copy(&buf, t.Reader())
+	return buf.Bytes(), err
+}
+
+// Reader returns the mix Render produces as a stream. It mixes one chunk of
+// the timeline at a time and reads only that part of every clip's Source,
+// so a timeline of clips on disk can be far longer than fits in memory.
+// Every call starts a new pass over the timeline and produces the same
+// audio.
+func (t *Timeline) Reader() *MixReader {
+	r := &MixReader{t: t, n: t.Len(), ch: max(t.Channels, 1)}
+	r.ducks = make([]*ducker, len(t.clips))
+	for i, c := range t.clips {
+		if c.Duck != nil {
+			r.ducks[i] = newDucker(c.Duck)
+			r.ducked = true
+			r.lookahead = max(r.lookahead, c.Duck.Attack)
+		}
+	}
+	bus := renderChunk
+	if t.Limiter != nil {
+		r.limit = newLimiter(t.Limiter, r.ch)
+		r.skip = r.limit.size - 1
+		bus += r.skip
+	}
+	if t.Dither {
+		r.rng = rand.New(rand.NewPCG(0, 0))
+	}
+	r.bus = make([]float32, bus*r.ch)
+	r.out = make([]byte, bus*r.ch*2)
+	return r
+}
+
+// MixReader streams the mix of a Timeline; see Timeline.Reader.
+type MixReader struct {
+	t     *Timeline
+	n, ch int
+	// pos is the first frame of the next chunk.
+	pos int
+	// ducks follows the ducking gain of each clip, nil for clips that are
+	// not ducked; lookahead is their longest attack.
+	ducks     []*ducker
+	ducked    bool
+	lookahead int
+	// limit is the state of the timeline's Limiter, whose delay is made
+	// up by dropping the first skip frames it returns.
+	limit *limiter
+	skip  int
+	rng   *rand.Rand
+
+	bus     []float32
+	out     []byte
+	pending []byte
+	scratch []byte
+	err     error
+
+	clipped int
+	peak    float64
+}
+
+// MixStats describes the part of a mix read so far.
+type MixStats struct {
+	// Clipped is the number of samples that were out of 16-bit range
+	// before limiting: the samples that were clamped, or that would have
+	// been without the Limiter.
+	Clipped int
+	// Peak is the highest sample level before limiting in dBFS, or -Inf if
+	// the mix is silent.
+	Peak float64
+}
+
+// Stats reports on the mix read so far.
+func (r *MixReader) Stats() MixStats {
+	peak := math.Inf(-1)
+	if r.peak > 0 {
+		peak = 20 * math.Log10(r.peak/32768)
+	}
+	return MixStats{Clipped: r.clipped, Peak: peak}
+}
+
+func (r *MixReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.pos >= r.n {
+			return 0, io.EOF
+		}
+		r.err = r.mix()
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// mix renders the chunk at pos into pending.
+func (r *MixReader) mix() error {
+	t, ch := r.t, r.ch
+	from, to := r.pos, min(r.pos+renderChunk, r.n)
+	r.pos = to
+
+	// Ducked clips follow the key level up to their attack time ahead.
+	var level []float64
+	if r.ducked {
+		var err error
+		level, err = t.keyLevel(from, min(to+r.lookahead, r.n), r.n, r.scratch)
+		if err != nil {
+			return err
+		}
+	}
+
+	acc := r.bus[:(to-from)*ch]
+	clear(acc)
+	for ci, c := range t.clips {
+		lo, hi := max(from, c.Start), min(to, c.End())
+		if lo >= hi {
+			continue
+		}
+		pcm, err := c.read(lo-c.Start, hi-c.Start, r.scratch)
+		if err != nil {
+			return err
+		}
+		r.scratch = pcm
+		if ch == 1 && c.channels() == 1 && c.GainDB == 0 && len(c.Fades) == 0 && c.Duck == nil {
+			for p := lo; p < hi; p++ {
+				acc[p-from] += float32(int16(binary.LittleEndian.Uint16(pcm[(p-lo)*2:])))
+			}
+			continue
+		}
+		m := c.Samples()
+		gain := DBToGain(c.GainDB)
+		pan := c.panGains(ch)
+		duck := r.ducks[ci]
+		for p := lo; p < hi; p++ {
+			i := p - c.Start
+			g := c.level(i, m, gain)
+			if duck != nil {
+				key := 0.0
+				if ahead := p + c.Duck.Attack; ahead < r.n {
+					key = level[ahead-from]
+				}
+				g *= duck.next(key)
+			}
+			frame := acc[(p-from)*ch:]
+			for k, pg := range pan {
+				v := c.sample(pcm, p-lo, k, ch)
+				if t.Dither {
+					frame[k] += float32(v * g * pg)
+				} else {
+					frame[k] += float32(math.Round(v * g * pg))
+				}
+			}
+		}
+	}
+
+	for _, v := range acc {
+		r.peak = max(r.peak, math.Abs(float64(v)))
+		if x := math.Round(float64(v)); x > 32767 || x < -32768 {
+			r.clipped++
+		}
+	}
+
+	frames := acc
+	if r.limit != nil {
+		if to == r.n {
+			// Flush the delay line with silence.
+			frames = r.bus[:len(acc)+(r.limit.size-1)*ch]
+			clear(frames[len(acc):])
+		}
+		r.limit.process(frames)
+		drop := min(r.skip, len(frames)/ch)
+		frames = frames[drop*ch:]
+		r.skip -= drop
+	}
+
+	out := r.out[:len(frames)*2]
+	for i, v := range frames {
+		x := float64(v)
+		if r.rng != nil {
+			x += r.rng.Float64() - r.rng.Float64()
+		}
+		binary.LittleEndian.PutUint16(out[i*2:], uint16(clamp16(int32(math.Round(x)))))
+	}
+	r.pending = out
+	return nil
+}
+
+// grow returns buf resized to n bytes, reallocating only if it is too small.
+func grow(buf []byte, n int) []byte {
+	if cap(buf) < n {
+		return make([]byte, n)
+	}
+	return buf[:n]
+}
+
+// DBToGain converts a level change in decibels to a linear amplitude factor.
+func DBToGain(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+func clamp16(v int32) int16 {
+	if v > 32767 {
+		return 32767
+	}
+	if v < -32768 {
+		return -32768
+	}
+	return int16(v)
+}
+
+// Loop returns 16-bit PCM src, with the given number of interleaved
+// channels, repeated until it is n frames long, or cut to n frames if it is
+// longer. Each repeat overlaps the end of the previous one by crossfade
+// frames, at most half of src, and the two are joined with an equal-power
+// crossfade so the seam is not heard. The result is computed from src as
+// it is read.
+func Loop(src Source, channels, n, crossfade int) Source {
+	size := 2 * max(channels, 1)
+	m := int(src.Size()) / size
+	crossfade = min(crossfade, m/2)
+	return &loopSource{src: src, size: size, m: m, n: n, crossfade: crossfade, step: m - crossfade}
+}
+
+// loopSource is the Source returned by Loop.
+type loopSource struct {
+	src Source
+	// size is the number of bytes per frame.
+	size int
+	// m is the length of src and n that of the loop in frames; repeats
+	// start every step frames.
+	m, n, crossfade, step int
+}
+
+func (l *loopSource) Size() int64 {
+	return int64(l.n * l.size)
+}
+
+// ReadAt reads whole frames; off must be a multiple of the frame size.
+func (l *loopSource) ReadAt(p []byte, off int64) (int, error) {
+	from := int(off) / l.size
+	if from >= l.n {
+		return 0, io.EOF
+	}
+	count := min(len(p)/l.size, l.n-from)
+	out := p[:count*l.size]
+	clear(out)
+	if l.m == 0 {
+		return l.result(count, len(p))
+	}
+
+	ch := l.size / 2
+	acc := make([]float64, count*ch)
+	var buf []byte
+	// Repeat r covers [r*step, r*step+m); walk those that overlap the read.
+	for r := max((from-l.m)/l.step, 0); r*l.step < from+count; r++ {
+		start := r * l.step
+		lo, hi := max(from, start), min(from+count, start+l.m)
+		if lo >= hi {
+			continue
+		}
+		buf = grow(buf, (hi-lo)*l.size)
+		if n, err := l.src.ReadAt(buf, int64((lo-start)*l.size)); n < len(buf) {
+			// Repeats are walked in order, so no later one reaches the
+			// frames before lo: those are complete.
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			l.store(out, acc[:(lo-from)*ch])
+			return (lo - from) * l.size, err
+		}
+		more := start+l.step < l.n
+		for p := lo; p < hi; p++ {
+			i := p - start
+			g := 1.0
+			if start > 0 && i < l.crossfade {
+				g *= EqualPower.gain(float64(i) / float64(l.crossfade))
+			}
+			if more && i >= l.step {
+				// Complementary to the fade-in of the next repeat.
+				g *= EqualPower.gain(float64(l.m-i) / float64(l.crossfade))
+			}
+			for k := range ch {
+				j := (p-lo)*ch + k
+				acc[(p-from)*ch+k] += float64(int16(binary.LittleEndian.Uint16(buf[j*2:]))) * g
+			}
+		}
+	}
+	l.store(out, acc)
+	return l.result(count, len(p))
+}
+
+// store writes the mixed samples acc to out as 16-bit PCM.
+func (l *loopSource) store(out []byte, acc []float64) {
+	for i, v := range acc {
+		binary.LittleEndian.PutUint16(out[i*2:], uint16(clamp16(int32(math.Round(v)))))
+	}
+}
+
+// result returns what ReadAt reports after reading count frames into a
+// buffer of size bytes.
+func (l *loopSource) result(count, size int) (int, error) {
+	if count*l.size < size {
+		return count * l.size, io.EOF
+	}
+	return count * l.size, nil
+}
@@ -0,0 +1,156 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// wavHeaderSize is the size of a canonical RIFF/WAVE header: the RIFF
+// chunk descriptor, a 16-byte fmt chunk and the data chunk header.
+const wavHeaderSize = 44
+
+// EncodeWAV wraps 16-bit PCM with the given sample rate and number of
+// interleaved channels in a WAV container. The header is written up front
+// with the final sizes, so the result can be streamed to a pipe; the
+// go-audio/wav encoder cannot do that, as it seeks back to fill in the
+// sizes when it is closed.
+func EncodeWAV(pcm []byte, sampleRate, channels int) []byte {
+	size := len(pcm) / 2 * 2
+	out := make([]byte, 0, wavHeaderSize+size)
+	out = append(out, wavHeader(sampleRate, channels, size)...)
+	return append(out, pcm[:size]...)
+}
+
+// wavHeader returns the header of a WAV file holding size bytes of 16-bit
+// PCM.
+func wavHeader(sampleRate, channels, size int) []byte {
+	blockAlign := channels * BitDepth / 8
+
+	h := make([]byte, wavHeaderSize)
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], uint32(wavHeaderSize-8+size))
+	copy(h[8:], "WAVE")
+	copy(h[12:], "fmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], 1) // WAVE_FORMAT_PCM
+	binary.LittleEndian.PutUint16(h[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(h[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(sampleRate*blockAlign))
+	binary.LittleEndian.PutUint16(h[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(h[34:], BitDepth)
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], uint32(size))
+	return h
+}
+
+// WAVWriter writes a WAV file of a length known in advance, passing the
+// 16-bit PCM written to it straight through to the underlying writer.
+type WAVWriter struct {
+	w io.Writer
+}
+
+// NewWAVWriter writes the header of a WAV file holding frames frames of
+// 16-bit PCM to w and returns a WAVWriter for the samples. WAV sizes are 32
+// bits, so the audio must be under 4 GiB.
+func NewWAVWriter(w io.Writer, sampleRate, channels, frames int) (*WAVWriter, error) {
+	size := frames * channels * 2
+	if size > math.MaxUint32-(wavHeaderSize-8) {
+		return nil, errors.New("audio is too long for WAV, which is limited to 4 GiB; use FLAC")
+	}
+	if _, err := w.Write(wavHeader(sampleRate, channels, size)); err != nil {
+		return nil, err
+	}
+	return &WAVWriter{w: w}, nil
+}
+
+// Write writes 16-bit PCM samples.
+func (w *WAVWriter) Write(p []byte) (int, error) {
+	return w.w.Write(p)
+}
+
+// Close does nothing; the header was complete from the start. It does not
+// close the underlying writer.
+func (w *WAVWriter) Close() error {
+	return nil
+}
+
+// WAV format tags of the fmt chunk.
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// decodeWAV decodes a WAV file of integer PCM from 8 to 32 bits, or of 32-
+// or 64-bit floats, into a Buffer. Chunk sizes that run past the end of the
+// file, as written by some streaming encoders, are cut to what is there.
+func decodeWAV(data []byte) (*Buffer, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+	var format, channels, rate, depth int
+	for p := 12; p+8 <= len(data); {
+		id := string(data[p : p+4])
+		size := int(binary.LittleEndian.Uint32(data[p+4:]))
+		body := data[p+8:]
+		size = min(size, len(body))
+		body = body[:size]
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("WAV fmt chunk is too short")
+			}
+			format = int(binary.LittleEndian.Uint16(body[0:]))
+			channels = int(binary.LittleEndian.Uint16(body[2:]))
+			rate = int(binary.LittleEndian.Uint32(body[4:]))
+			depth = int(binary.LittleEndian.Uint16(body[14:]))
+			if format == wavFormatExtensible && size >= 26 {
+				// The sub-format GUID starts with the format tag.
+				format = int(binary.LittleEndian.Uint16(body[24:]))
+			}
+		case "data":
+			if channels == 0 || rate == 0 {
+				return nil, errors.New("WAV file has no valid fmt chunk before its data")
+			}
+			return decodeWAVData(body, format, rate, channels, depth)
+		}
+		p += 8 + size + size&1
+	}
+	return nil, errors.New("WAV file has no data chunk")
+}
+
+// decodeWAVData converts the samples of a WAV data chunk.
+func decodeWAVData(body []byte, format, rate, channels, depth int) (*Buffer, error) {
+	width := (depth + 7) / 8
+	supported := format == wavFormatPCM && width >= 1 && width <= 4 ||
+		format == wavFormatFloat && (width == 4 || width == 8)
+	if !supported {
+		return nil, fmt.Errorf("unsupported WAV encoding: format %d with %d bits per sample", format, depth)
+	}
+
+	frames := len(body) / (width * channels)
+	b := NewBuffer(rate, channels, frames)
+	for i := range b.Samples {
+		s := body[i*width:]
+		var v float64
+		switch {
+		case format == wavFormatFloat && width == 4:
+			v = float64(math.Float32frombits(binary.LittleEndian.Uint32(s)))
+		case format == wavFormatFloat:
+			v = math.Float64frombits(binary.LittleEndian.Uint64(s))
+		case width == 1:
+			v = (float64(s[0]) - 128) / 128
+		case width == 2:
+			v = float64(int16(binary.LittleEndian.Uint16(s))) / (1 << 15)
+		case width == 3:
+			v = float64(int32(uint32(s[0])<<8|uint32(s[1])<<16|uint32(s[2])<<24)) / (1 << 31)
+		default:
+			v = float64(int32(binary.LittleEndian.Uint32(s))) / (1 << 31)
+		}
+		b.Samples[i] = float32(v)
+	}
+	return b, nil
+}
@@ -0,0 +1,113 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	goaudio "github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+)
+
+// TestWAVReferenceDecoder reads the encoder's output with go-audio/wav.
+func TestWAVReferenceDecoder(t *testing.T) {
+	for _, tt := range []struct{ sampleRate, channels, frames int }{
+		{44100, 1, 1000},
+		{48000, 2, 4801},
+		{8000, 2, 0},
+	} {
+		pcm := tone(tt.sampleRate, tt.channels, tt.frames, 440, -1)
+		d := wav.NewDecoder(bytes.NewReader(EncodeWAV(pcm, tt.sampleRate, tt.channels)))
+		buf, err := d.FullPCMBuffer()
+		if err != nil {
+			t.Fatalf("%+v: %v", tt, err)
+		}
+		if int(d.SampleRate) != tt.sampleRate || int(d.NumChans) != tt.channels || d.BitDepth != 16 {
+			t.Errorf("%+v: header says %d Hz, %d channels, %d bits", tt, d.SampleRate, d.NumChans, d.BitDepth)
+		}
+		if len(buf.Data) != len(pcm)/2 {
+			t.Fatalf("%+v: decoded %d samples, want %d", tt, len(buf.Data), len(pcm)/2)
+		}
+		for i, v := range buf.Data {
+			if want := int(int16(binary.LittleEndian.Uint16(pcm[i*2:]))); v != want {
+				t.Fatalf("%+v: sample %d is %d, want %d", tt, i, v, want)
+			}
+		}
+	}
+}
+
+// TestWAVDecodesReferenceEncoder reads files written by go-audio/wav.
+func TestWAVDecodesReferenceEncoder(t *testing.T) {
+	for _, depth := range []int{8, 16, 24, 32} {
+		path := filepath.Join(t.TempDir(), "ref.wav")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		max := 1<<(depth-1) - 1
+		data := make([]int, 2*300)
+		for i := range data {
+			data[i] = (i*7919)%(2*max) - max
+			if depth == 8 {
+				// 8-bit WAV is unsigned, which go-audio leaves to the caller.
+				data[i] += 128
+			}
+		}
+		enc := wav.NewEncoder(f, 22050, depth, 2, 1)
+		if err := enc.Write(&goaudio.IntBuffer{Format: &goaudio.Format{NumChannels: 2, SampleRate: 22050}, Data: data, SourceBitDepth: depth}); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		file, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := DecodeFile(file)
+		if err != nil {
+			t.Fatalf("%d bits: %v", depth, err)
+		}
+		if buf.SampleRate != 22050 || buf.Channels != 2 || len(buf.Samples) != len(data) {
+			t.Fatalf("%d bits: decoded %d samples of %d channels at %d Hz", depth, len(buf.Samples), buf.Channels, buf.SampleRate)
+		}
+		for i, v := range data {
+			if depth == 8 {
+				v -= 128
+			}
+			want := float32(float64(v) / float64(max+1))
+			if buf.Samples[i] != want {
+				t.Fatalf("%d bits: sample %d is %v, want %v", depth, i, buf.Samples[i], want)
+			}
+		}
+	}
+}
+
+func TestWAVWriterMatchesEncodeWAV(t *testing.T) {
+	pcm := tone(44100, 2, 3000, 440, -3)
+	var buf bytes.Buffer
+	w, err := NewWAVWriter(&buf, 44100, 2, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := pcm; len(p) > 0; {
+		n := min(777, len(p))
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), EncodeWAV(pcm, 44100, 2)) {
+		t.Error("streamed WAV differs from EncodeWAV")
+	}
+	if _, err := NewWAVWriter(&buf, 44100, 2, 1<<30); err == nil {
+		t.Error("NewWAVWriter accepted audio over 4 GiB")
+	}
+}
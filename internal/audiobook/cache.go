@@ -0,0 +1,179 @@
+package audiobook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deegital/elevencli/internal/atomicfile"
+	"github.com/deegital/elevencli/internal/elevenlabs"
+)
+
+// cacheKeyVersion is bumped whenever the key layout or the meaning of a
+// cached file changes, so stale entries are never reused.
+const cacheKeyVersion = 2
+
+// Cache stores rendered block PCM on disk, keyed by a hash of every input
+// that affects what the API returns for the block.
+type Cache struct {
+	dir string
+
+	mu     sync.Mutex
+	hits   int
+	misses int
+}
+
+// DefaultCacheDir returns the per-user cache directory for rendered blocks.
+func DefaultCacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user cache directory: %w", err)
+	}
+	return filepath.Join(base, "elevencli", "blocks"), nil
+}
+
+// OpenCache returns a cache rooted at dir, creating it if needed.
+func OpenCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// ReadCache returns a cache rooted at dir for lookups only, without
+// creating the directory; a missing directory is an empty cache.
+func ReadCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// Dir returns the cache root directory.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Stats returns the number of lookups that were served from and missed the
+// cache.
+func (c *Cache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".pcm")
+}
+
+// Get returns the cached PCM for key. A hit refreshes the entry's
+// modification time so Prune keeps blocks that are still in use.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	p := c.path(key)
+	data, err := os.ReadFile(p)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	return data, true
+}
+
+// Has reports whether key is cached without reading the entry or counting
+// a lookup.
+func (c *Cache) Has(key string) bool {
+	_, err := os.Stat(c.path(key))
+	return err == nil
+}
+
+// Put stores pcm under key. The file is written to a temporary name and
+// renamed into place so concurrent readers never see a partial entry.
+func (c *Cache) Put(key string, pcm []byte) error {
+	p := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	if err := atomicfile.Write(p, pcm, 0600); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// Prune removes entries that have not been written or read for longer than
+// maxAge and returns how many were removed.
+func (c *Cache) Prune(maxAge time.Duration) (int, error) {
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".pcm") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to prune cache: %w", err)
+	}
+	return removed, nil
+}
+
+// cacheKey hashes every input that determines the audio returned for the
+// block. Blocks that are not rendered through the API have no key.
+func cacheKey(block Block, outputFormat string) (string, bool) {
+	if block.Type != "tts" && block.Type != "sfx" {
+		return "", false
+	}
+	inputs := struct {
+		Version       int                       `json:"v"`
+		Type          string                    `json:"type"`
+		Voice         string                    `json:"voice,omitempty"`
+		Model         string                    `json:"model,omitempty"`
+		Text          string                    `json:"text"`
+		VoiceSettings *elevenlabs.VoiceSettings `json:"voice_settings,omitempty"`
+		Duration      float64                   `json:"duration"`
+		OutputFormat  string                    `json:"output_format"`
+	}{
+		Version:      cacheKeyVersion,
+		Type:         block.Type,
+		Text:         block.Text,
+		OutputFormat: outputFormat,
+	}
+	switch block.Type {
+	case "sfx":
+		inputs.Duration = block.Duration
+	case "tts":
+		inputs.Voice = block.Voice
+		inputs.Model = ttsModel(block)
+		if settings := block.VoiceSettings(); !settings.IsZero() {
+			inputs.VoiceSettings = &settings
+		}
+	}
+	data, _ := json.Marshal(inputs)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), true
+}
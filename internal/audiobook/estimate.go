@@ -0,0 +1,184 @@
+package audiobook
+
+import (
+	"math"
+	"os"
+	"strings"
+
+	"github.com/deegital/elevencli/internal/audio"
+)
+
+// Credit costs used for estimates. They follow ElevenLabs' published pricing
+// at the time of writing and may differ from what a given plan is billed.
+const (
+	// creditsPerChar is the cost of one character on full-quality models.
+	creditsPerChar = 1.0
+	// creditsPerCharFast is the cost of one character on Flash and Turbo
+	// models, which bill half a credit per character.
+	creditsPerCharFast = 0.5
+	// sfxCreditsAuto is the cost of a sound effect without a duration.
+	sfxCreditsAuto = 100.0
+	// sfxCreditsPerSecond is the cost per second of a sound effect with an
+	// explicit duration.
+	sfxCreditsPerSecond = 20.0
+
+	// ttsCharsPerSecond approximates narration pace (~150 words per minute).
+	ttsCharsPerSecond = 15.0
+	// sfxAutoDuration is the assumed length of a sound effect whose duration
+	// is chosen by the API.
+	sfxAutoDuration = 5.0
+)
+
+// Call is one API request a render would make.
+type Call struct {
+	// Block is the zero-based index of the block in the script.
+	Block    int
+	Type     string
+	Voice    string
+	Model    string
+	Text     string
+	Chars    int
+	Credits  float64
+	Duration float64
+	// Cached is true when the block would be served from the render cache
+	// and therefore not billed.
+	Cached bool
+	// Saved is true when a previous run already rendered the block into the
+	// work directory, so resuming does not bill it again.
+	Saved bool
+}
+
+// Estimate summarizes the API usage and output length of a script.
+type Estimate struct {
+	Calls []Call
+	// CharsByVoice and CharsByModel total the TTS characters of the
+	// script.
+	CharsByVoice map[string]int
+	CharsByModel map[string]int
+	// CachedCharsByVoice and CachedCharsByModel total the part of those in
+	// cached and saved blocks, which is not billed.
+	CachedCharsByVoice map[string]int
+	CachedCharsByModel map[string]int
+	// Credits is the estimated total cost, excluding cached and saved
+	// blocks.
+	Credits float64
+	// Duration is the estimated length of the assembled audio in seconds.
+	Duration float64
+}
+
+// EstimateScript lists the API calls needed to render script and estimates
+// their cost and the final duration without contacting the API. When cache
+// is non-nil, blocks already in it for the API output format are marked as
+// cached and cost nothing; so do blocks that work, when non-nil, holds from a
+// previous run.
+func EstimateScript(script *Script, cache *Cache, work *WorkDir, format string) *Estimate {
+	est := &Estimate{
+		CharsByVoice:       map[string]int{},
+		CharsByModel:       map[string]int{},
+		CachedCharsByVoice: map[string]int{},
+		CachedCharsByModel: map[string]int{},
+	}
+
+	add := func(call Call, block Block) {
+		call.Saved = work != nil && work.Has(call.Block)
+		est.add(call, cache, block, format)
+	}
+
+	durations := make([]float64, len(script.Blocks))
+	for i, block := range script.Blocks {
+		switch block.Type {
+		case "tts":
+			chars := len([]rune(block.Text))
+			speed := 1.0
+			if block.Speed != nil {
+				speed = *block.Speed
+			}
+			model := ttsModel(block)
+			call := Call{
+				Block:    i,
+				Type:     block.Type,
+				Voice:    block.Voice,
+				Model:    model,
+				Text:     block.Text,
+				Chars:    chars,
+				Credits:  float64(chars) * ttsCreditsPerChar(model),
+				Duration: float64(chars) / ttsCharsPerSecond / speed,
+			}
+			durations[i] = call.Duration
+			add(call, block)
+
+		case "sfx":
+			call := Call{
+				Block:    i,
+				Type:     block.Type,
+				Text:     block.Text,
+				Credits:  sfxCreditsAuto,
+				Duration: sfxAutoDuration,
+			}
+			if block.Duration > 0 {
+				call.Credits = math.Ceil(block.Duration * sfxCreditsPerSecond)
+				call.Duration = block.Duration
+			}
+			durations[i] = call.Duration
+			add(call, block)
+
+		case "file":
+			// Files cost nothing; their length is read from the file.
+			if data, err := os.ReadFile(script.filePath(&block)); err == nil {
+				if buf, err := audio.DecodeFile(data); err == nil {
+					durations[i] = buf.Duration()
+				}
+			}
+
+		case "silence":
+			durations[i] = block.Duration
+		}
+	}
+
+	est.Duration = assembledDuration(script, durations)
+	return est
+}
+
+func (e *Estimate) add(call Call, cache *Cache, block Block, format string) {
+	if cache != nil && !call.Saved {
+		if key, ok := cacheKey(block, format); ok && cache.Has(key) {
+			call.Cached = true
+		}
+	}
+	e.Calls = append(e.Calls, call)
+	if call.Type == "tts" {
+		e.CharsByVoice[call.Voice] += call.Chars
+		e.CharsByModel[call.Model] += call.Chars
+	}
+	if call.Cached || call.Saved {
+		if call.Type == "tts" {
+			e.CachedCharsByVoice[call.Voice] += call.Chars
+			e.CachedCharsByModel[call.Model] += call.Chars
+		}
+		return
+	}
+	e.Credits += call.Credits
+}
+
+// ttsCreditsPerChar returns the per-character cost of a TTS model.
+func ttsCreditsPerChar(model string) float64 {
+	if strings.Contains(model, "flash") || strings.Contains(model, "turbo") {
+		return creditsPerCharFast
+	}
+	return creditsPerChar
+}
+
+// assembledDuration lays the estimated block durations out with the same
+// timeline rules Generate uses.
+func assembledDuration(script *Script, durations []float64) float64 {
+	layers, err := planLayers(script)
+	if err != nil {
+		return 0
+	}
+	lengths := make([]int, len(durations))
+	for i, d := range durations {
+		lengths[i] = audio.Samples(d, audio.SampleRate)
+	}
+	_, total := arrange(script, layers, lengths, audio.SampleRate)
+	return audio.Seconds(total, audio.SampleRate)
+}
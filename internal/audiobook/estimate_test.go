@@ -0,0 +1,78 @@
+package audiobook
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEstimateScript(t *testing.T) {
+	script := &Script{Blocks: []Block{
+		{Type: "tts", Voice: "a", Text: "one two", Model: "eleven_multilingual_v2"},
+		{Type: "tts", Voice: "a", Text: "three", Model: "eleven_flash_v2_5"},
+		{Type: "tts", Voice: "b", Text: "four", Model: "eleven_multilingual_v2"},
+		{Type: "silence", Duration: 1},
+		{Type: "sfx", Text: "rain", Duration: 2},
+	}}
+
+	cache := ReadCache(filepath.Join(t.TempDir(), "cache"))
+	key, _ := cacheKey(script.Blocks[0], testFormat)
+	if err := cache.Put(key, []byte{0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	w, err := OpenWorkDir(dir, script, testFormat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Save(2, []byte{0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	work, err := ReadWorkDir(dir, script, testFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	est := EstimateScript(script, cache, work, testFormat)
+
+	if len(est.Calls) != 4 || !est.Calls[0].Cached || est.Calls[1].Cached || est.Calls[1].Saved || !est.Calls[2].Saved {
+		t.Errorf("calls %+v, want block 1 cached and block 3 saved", est.Calls)
+	}
+	// Only the flash block and the sound effect are billed.
+	if want := 5*creditsPerCharFast + 2*sfxCreditsPerSecond; est.Credits != want {
+		t.Errorf("credits %g, want %g", est.Credits, want)
+	}
+	for _, tt := range []struct {
+		name      string
+		got, want map[string]int
+	}{
+		{"by voice", est.CharsByVoice, map[string]int{"a": 12, "b": 4}},
+		{"cached by voice", est.CachedCharsByVoice, map[string]int{"a": 7, "b": 4}},
+		{"by model", est.CharsByModel, map[string]int{"eleven_multilingual_v2": 11, "eleven_flash_v2_5": 5}},
+		{"cached by model", est.CachedCharsByModel, map[string]int{"eleven_multilingual_v2": 11}},
+	} {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("characters %s: %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestReadWorkDirLeavesDiskAlone(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "work")
+	if _, err := ReadWorkDir(dir, testScript("one"), testFormat); err == nil {
+		t.Error("no error without a manifest")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("work directory was created: %v", err)
+	}
+
+	cache := ReadCache(filepath.Join(t.TempDir(), "cache"))
+	if cache.Has("0000") {
+		t.Error("empty cache has an entry")
+	}
+	if _, err := os.Stat(cache.Dir()); !os.IsNotExist(err) {
+		t.Errorf("cache directory was created: %v", err)
+	}
+}
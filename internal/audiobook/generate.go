@@ -1,151 +1,387 @@
 package audiobook
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
-
-	elevenlabs "github.com/haguro/elevenlabs-go"
+	"sync"
 
 	"github.com/deegital/elevencli/internal/audio"
+	"github.com/deegital/elevencli/internal/elevenlabs"
 )
 
-// GenerateResult holds the output of audiobook generation.
+// GenerateResult holds the output of audiobook generation. The audio lives
+// in temporary files until Close.
 type GenerateResult struct {
-	// MergedPCM is the final concatenated/mixed PCM audio.
-	MergedPCM []byte
-	// BlockPCMs holds individual block PCM data (indexed by block position).
-	BlockPCMs [][]byte
+	// Mix is the assembled audiobook. Its Reader streams the final mix as
+	// 16-bit PCM with Channels interleaved channels, reading the blocks
+	// from disk as it goes; it can be read any number of times.
+	Mix *audio.Timeline
+	// Blocks holds the PCM of each block as rendered, before any
+	// background layers are mixed in (indexed by block position).
+	Blocks []audio.Source
+	// BlockChannels is the number of channels of each block: 1, or 2 for
+	// a stereo file block in a stereo mix.
+	BlockChannels []int
+	// SampleRate is the sample rate of Mix and Blocks.
+	SampleRate int
+	// Channels is the number of channels of Mix.
+	Channels int
+	// Tag holds the script's metadata and chapters for MP3 output, or is
+	// nil if the script has neither.
+	Tag *audio.ID3Tag
+
+	spool *spool
 }
 
-type sfxRequest struct {
-	Text            string  `json:"text"`
-	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+// Close deletes the temporary files holding the audio.
+func (r *GenerateResult) Close() error {
+	return r.spool.Remove()
 }
 
-// Generate processes an audiobook script and returns PCM audio data.
-func Generate(script *Script, apiKey string, client *elevenlabs.Client) (*GenerateResult, error) {
-	var (
-		segments  [][]byte // sequential PCM segments to concatenate
-		blockPCMs [][]byte // one per block for --keep-blocks
-		pendingBG []byte   // background SFX PCM waiting to be mixed into next TTS
-	)
+// DefaultFormat is the API output format requested for blocks unless
+// Options.Format says otherwise.
+const DefaultFormat = "pcm_44100"
 
-	for i, block := range script.Blocks {
-		fmt.Fprintf(os.Stderr, "Processing block %d/%d (%s)...\n", i+1, len(script.Blocks), block.Type)
+// Options controls how Generate renders a script.
+type Options struct {
+	// Concurrency is the number of blocks rendered in parallel. Values
+	// below 1 are treated as 1.
+	Concurrency int
+	// Cache, when non-nil, serves unchanged TTS and SFX blocks from disk and
+	// stores newly rendered ones.
+	Cache *Cache
+	// WorkDir, when non-nil, receives every finished block so a failed run
+	// can be resumed; blocks it already holds are not rendered again.
+	WorkDir *WorkDir
+	// Format is the raw API output format blocks are requested in, such as
+	// "pcm_22050" or "ulaw_8000". Defaults to DefaultFormat.
+	Format string
+	// SampleRate is the rate blocks are resampled to and mixed at. Defaults
+	// to the sample rate of Format.
+	SampleRate int
+	// Channels is the number of channels of the mix: 1 or 2. Defaults to 2
+	// if the script pans any block and 1 otherwise.
+	Channels int
+	// Limiter, when non-nil, keeps the mix under its ceiling instead of
+	// letting overlapping blocks clip.
+	Limiter *audio.Limiter
+	// Dither mixes blocks at full precision and dithers the result to 16
+	// bits.
+	Dither bool
+	// SpoolDir is where finished blocks are kept while the book is
+	// assembled. Defaults to WorkDir if there is one, else the system
+	// temporary directory.
+	SpoolDir string
+}
 
-		switch block.Type {
-		case "tts":
-			pcm, err := generateTTS(block, client)
-			if err != nil {
-				return nil, fmt.Errorf("block %d (tts): %w", i, err)
-			}
+// formats resolves the API format and mixing rate of opts.
+func (o Options) formats() (string, audio.Format, int, error) {
+	name := o.Format
+	if name == "" {
+		name = DefaultFormat
+	}
+	f, err := audio.ParseFormat(name)
+	if err != nil {
+		return "", audio.Format{}, 0, err
+	}
+	rate := o.SampleRate
+	if rate == 0 {
+		rate = f.SampleRate
+	}
+	return name, f, rate, nil
+}
 
-			if pendingBG != nil {
-				pcm = audio.Mix(pcm, pendingBG)
-				pendingBG = nil
-			}
+// Generate processes an audiobook script into a GenerateResult, which the
+// caller must Close. Blocks are rendered through a pool of opts.Concurrency
+// workers; each finished block is brought to 16-bit PCM at the mixing rate
+// and spooled to disk, so memory use does not grow with the length of the
+// book. The blocks are then placed on a timeline: sequential blocks in
+// script order, background layers underneath them. Cancelling ctx aborts
+// in-flight requests and returns ctx.Err(); blocks finished before that
+// remain in opts.WorkDir.
+func Generate(ctx context.Context, script *Script, client *elevenlabs.Client, opts Options) (*GenerateResult, error) {
+	name, format, rate, err := opts.formats()
+	if err != nil {
+		return nil, err
+	}
+	tag, err := script.tag()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := opts.SpoolDir
+	if dir == "" && opts.WorkDir != nil {
+		dir = opts.WorkDir.Dir()
+	}
+	sp, err := newSpool(dir, len(script.Blocks))
+	if err != nil {
+		return nil, err
+	}
 
-			segments = append(segments, pcm)
-			blockPCMs = append(blockPCMs, pcm)
+	channels := opts.Channels
+	if channels == 0 {
+		channels = 1
+		if script.Panned() {
+			channels = 2
+		}
+	}
 
-		case "sfx":
-			pcm, err := generateSFX(block, apiKey)
+	// Bring every block to 16-bit PCM at the mixing rate, trimmed if the
+	// script asks for it. Blocks are mono, except that stereo files keep
+	// both channels in a stereo mix; other files are mixed down, and so are
+	// stereo files whose channels are the same, such as every MP3 of a mono
+	// recording, which decodes to two channels.
+	finish := func(i int, data []byte) error {
+		var buf *audio.Buffer
+		var err error
+		if b := &script.Blocks[i]; b.Type == "file" {
+			buf, err = audio.DecodeFile(data)
 			if err != nil {
-				return nil, fmt.Errorf("block %d (sfx): %w", i, err)
+				return fmt.Errorf("%s: %w", b.Path, err)
 			}
-
-			if block.Background {
-				pendingBG = pcm
-				blockPCMs = append(blockPCMs, pcm)
-			} else {
-				segments = append(segments, pcm)
-				blockPCMs = append(blockPCMs, pcm)
+			if buf.Channels != 2 || channels != 2 || buf.DualMono() {
+				buf = buf.Mono()
 			}
-
-		case "silence":
-			pcm := audio.Silence(block.Duration)
-			segments = append(segments, pcm)
-			blockPCMs = append(blockPCMs, pcm)
+		} else {
+			buf, err = audio.Decode(data, format)
 		}
+		if err != nil {
+			return err
+		}
+		pcm := buf.Resample(rate).PCM16()
+		if trim, threshold := script.trim(i); trim {
+			pcm = audio.TrimSilence(pcm, rate, buf.Channels, threshold)
+		}
+		return sp.put(i, pcm, buf.Channels)
 	}
-
-	// If there's a trailing background SFX with no following TTS, append it.
-	if pendingBG != nil {
-		segments = append(segments, pendingBG)
+	if err := renderBlocks(ctx, script, client, opts, name, finish); err != nil {
+		sp.Remove()
+		return nil, err
 	}
 
-	merged := audio.Concat(segments...)
+	mix, chapters, err := assemble(script, sp.blocks, sp.channels, rate, channels)
+	if err != nil {
+		sp.Remove()
+		return nil, err
+	}
+	mix.Limiter = opts.Limiter
+	mix.Dither = opts.Dither
+	if len(chapters) > 0 {
+		if tag == nil {
+			tag = &audio.ID3Tag{}
+		}
+		tag.Chapters = chapters
+	}
 
 	return &GenerateResult{
-		MergedPCM: merged,
-		BlockPCMs: blockPCMs,
+		Mix:           mix,
+		Blocks:        sp.blocks,
+		BlockChannels: sp.channels,
+		SampleRate:    rate,
+		Channels:      channels,
+		Tag:           tag,
+		spool:         sp,
 	}, nil
 }
 
-func generateTTS(block Block, client *elevenlabs.Client) ([]byte, error) {
-	req := elevenlabs.TextToSpeechRequest{
-		Text:    block.Text,
-		ModelID: block.Model,
+// renderBlocks produces the raw audio of every block in the API format
+// named format, or the contents of its file for file blocks, and hands it
+// to finish with the block's position, from the worker that rendered it;
+// blocks finished by a previous run come first.
+// Up to concurrency blocks are rendered at once. After the first failure
+// no new blocks are started; the error of the earliest failed block is
+// returned once in-flight requests have finished.
+func renderBlocks(ctx context.Context, script *Script, client *elevenlabs.Client, opts Options, format string, finish func(int, []byte) error) error {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
 	}
 
-	if block.Model == "" {
-		req.ModelID = "eleven_multilingual_v2"
+	total := len(script.Blocks)
+	resumed := make([]bool, total)
+	errs := make([]error, total)
+
+	var (
+		mu     sync.Mutex
+		failed bool
+		done   int
+	)
+
+	if opts.WorkDir != nil {
+		for i := range script.Blocks {
+			if pcm, ok := opts.WorkDir.Load(i); ok {
+				if err := finish(i, pcm); err != nil {
+					return fmt.Errorf("block %d (%s): %w", i, script.Blocks[i].Type, err)
+				}
+				resumed[i] = true
+				done++
+			}
+		}
+		if done > 0 {
+			fmt.Fprintf(os.Stderr, "Resuming: %d/%d blocks already rendered\n", done, total)
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// The dispatcher may have handed this job over before
+				// another worker failed; drop it rather than bill it.
+				mu.Lock()
+				stop := failed
+				mu.Unlock()
+				if stop {
+					continue
+				}
+
+				var pcm []byte
+				var cached bool
+				var err error
+				if block := &script.Blocks[i]; block.Type == "file" {
+					// Local files are read again on resume rather than
+					// copied into the work directory.
+					pcm, err = os.ReadFile(script.filePath(block))
+				} else {
+					pcm, cached, err = renderBlock(ctx, *block, client, opts.Cache, format)
+					// Silence is generated again for free. Blocks from the
+					// cache are kept too, as the cache may be pruned or
+					// cleared before the run is resumed.
+					if err == nil && opts.WorkDir != nil && block.Type != "silence" {
+						err = opts.WorkDir.Save(i, pcm)
+					}
+				}
+				if err == nil {
+					err = finish(i, pcm)
+				}
+
+				mu.Lock()
+				if err != nil {
+					errs[i] = fmt.Errorf("block %d (%s): %w", i, script.Blocks[i].Type, err)
+					failed = true
+				} else {
+					done++
+					source := ""
+					if cached {
+						source = ", cached"
+					}
+					fmt.Fprintf(os.Stderr, "Rendered block %d/%d (%s%s) [%d/%d done]\n",
+						i+1, total, script.Blocks[i].Type, source, done, total)
+				}
+				mu.Unlock()
+			}
+		}()
 	}
 
-	if block.Stability != 0 || block.SimilarityBoost != 0 || block.Style != 0 {
-		req.VoiceSettings = &elevenlabs.VoiceSettings{
-			Stability:       block.Stability,
-			SimilarityBoost: block.SimilarityBoost,
-			Style:           block.Style,
+dispatch:
+	for i := range script.Blocks {
+		if resumed[i] {
+			continue
+		}
+		mu.Lock()
+		stop := failed
+		mu.Unlock()
+		if stop {
+			break
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
 		}
 	}
+	close(jobs)
+	wg.Wait()
 
-	pcm, err := client.TextToSpeech(block.Voice, req, elevenlabs.OutputFormat("pcm_44100"))
-	if err != nil {
-		return nil, fmt.Errorf("TTS API request failed: %w", err)
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	return pcm, nil
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func generateSFX(block Block, apiKey string) ([]byte, error) {
-	req := sfxRequest{Text: block.Text}
-	if block.Duration > 0 {
-		req.DurationSeconds = block.Duration
+// renderBlock produces the raw audio for a single block in format,
+// consulting cache first when one is given. cached reports whether the audio
+// came from cache.
+func renderBlock(ctx context.Context, block Block, client *elevenlabs.Client, cache *Cache, format string) (pcm []byte, cached bool, err error) {
+	key, cacheable := cacheKey(block, format)
+	if cache != nil && cacheable {
+		if pcm, ok := cache.Get(key); ok {
+			return pcm, true, nil
+		}
 	}
 
-	body, err := json.Marshal(req)
+	switch block.Type {
+	case "tts":
+		pcm, err = generateTTS(ctx, block, client, format)
+	case "sfx":
+		pcm, err = generateSFX(ctx, block, client, format)
+	case "silence":
+		f, err := audio.ParseFormat(format)
+		if err != nil {
+			return nil, false, err
+		}
+		return audio.Silence(block.Duration, f), false, nil
+	default:
+		return nil, false, fmt.Errorf("unknown block type %q", block.Type)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to build SFX request: %w", err)
+		return nil, false, err
 	}
 
-	url := "https://api.elevenlabs.io/v1/sound-generation?output_format=pcm_44100"
-	httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create SFX request: %w", err)
+	if cache != nil && cacheable {
+		if err := cache.Put(key, pcm); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	return pcm, false, nil
+}
+
+func generateTTS(ctx context.Context, block Block, client *elevenlabs.Client, format string) ([]byte, error) {
+	req := elevenlabs.TextToSpeechRequest{
+		Text:    block.Text,
+		ModelID: ttsModel(block),
+	}
+
+	if settings := block.VoiceSettings(); !settings.IsZero() {
+		req.VoiceSettings = &settings
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("xi-api-key", apiKey)
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	pcm, err := client.TextToSpeech(ctx, block.Voice, req, format)
 	if err != nil {
-		return nil, fmt.Errorf("SFX API request failed: %w", err)
+		return nil, fmt.Errorf("TTS API request failed: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("SFX API error (%d): %s", resp.StatusCode, string(respBody))
+	return pcm, nil
+}
+
+func generateSFX(ctx context.Context, block Block, client *elevenlabs.Client, format string) ([]byte, error) {
+	req := elevenlabs.SoundGenerationRequest{Text: block.Text}
+	if block.Duration > 0 {
+		req.DurationSeconds = block.Duration
 	}
 
-	pcm, err := io.ReadAll(resp.Body)
+	pcm, err := client.SoundGeneration(ctx, req, format)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read SFX response: %w", err)
+		return nil, fmt.Errorf("SFX API request failed: %w", err)
 	}
 
 	return pcm, nil
 }
+
+// ttsModel returns the model used for a TTS block.
+func ttsModel(block Block) string {
+	if block.Model == "" {
+		return DefaultModel
+	}
+	return block.Model
+}
@@ -0,0 +1,110 @@
+package audiobook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deegital/elevencli/internal/elevenlabs"
+	"github.com/deegital/elevencli/internal/mockserver"
+)
+
+func TestGenerate(t *testing.T) {
+	srv := httptest.NewServer(mockserver.New(mockserver.Options{}))
+	defer srv.Close()
+	client := elevenlabs.NewClient(elevenlabs.Options{BaseURL: srv.URL, APIKey: "test", MaxAttempts: 1})
+	ctx := context.Background()
+
+	script := &Script{
+		Metadata: &Metadata{Title: "Storm"},
+		Blocks: []Block{
+			{Type: "tts", Voice: "JBFqnCBsd6RMkjVDRZzb", Text: "It was a dark and stormy night.", Chapter: "Opening"},
+			{Type: "silence", Duration: 1},
+			{Type: "sfx", Text: "thunder", Duration: 2, Chapter: "Thunder"},
+			{Type: "sfx", Text: "rain", Background: true, Loop: true},
+			{Type: "tts", Voice: "EXAVITQu4vr4xnSDxMaL", Text: "The rain fell.", Pan: 0.3},
+		},
+	}
+	if err := script.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	const rate = 22050
+	// The narration is as long as the mock server makes it.
+	speech := func(b Block) int {
+		data, err := client.TextToSpeech(ctx, b.Voice, elevenlabs.TextToSpeechRequest{Text: b.Text, ModelID: ttsModel(b)}, "pcm_22050")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(data) / 2
+	}
+	first, last := speech(script.Blocks[0]), speech(script.Blocks[4])
+	total := first + rate + 2*rate + last
+
+	result, err := Generate(ctx, script, client, Options{Concurrency: 2, Format: "pcm_22050", SpoolDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer result.Close()
+
+	// The panned block makes the mix stereo.
+	if result.SampleRate != rate || result.Channels != 2 || result.Mix.Channels != 2 {
+		t.Errorf("mix is %d Hz with %d channels (timeline %d), want %d Hz stereo",
+			result.SampleRate, result.Channels, result.Mix.Channels, rate)
+	}
+	if got := result.Mix.Len(); got != total {
+		t.Errorf("mix is %d samples long, want %d", got, total)
+	}
+	n, err := io.Copy(io.Discard, result.Mix.Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(total * 2 * 2); n != want {
+		t.Errorf("mix reader produced %d bytes, want %d", n, want)
+	}
+
+	at := func(samples int) time.Duration {
+		return time.Duration(samples) * time.Second / rate
+	}
+	tag := result.Tag
+	if tag == nil || tag.Title != "Storm" || len(tag.Chapters) != 2 {
+		t.Fatalf("tag %+v, want the title and 2 chapters", tag)
+	}
+	for i, want := range []struct {
+		title      string
+		start, end time.Duration
+	}{
+		{"Opening", 0, at(first + rate)},
+		{"Thunder", at(first + rate), at(total)},
+	} {
+		c := tag.Chapters[i]
+		if c.Title != want.title || c.Start != want.start || c.End != want.end {
+			t.Errorf("chapter %d: %q %v-%v, want %q %v-%v", i, c.Title, c.Start, c.End, want.title, want.start, want.end)
+		}
+	}
+}
+
+func TestGenerateStopsAfterFailure(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"detail": "rejected"}`))
+	}))
+	defer srv.Close()
+	client := elevenlabs.NewClient(elevenlabs.Options{BaseURL: srv.URL, APIKey: "test", MaxAttempts: 1})
+
+	script := testScript("one", "two", "three", "four")
+	_, err := Generate(context.Background(), script, client, Options{Concurrency: 1, Format: "pcm_22050", SpoolDir: t.TempDir()})
+	if err == nil {
+		t.Fatal("no error")
+	}
+	// With one worker, no request may follow the one that failed.
+	if n := calls.Load(); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
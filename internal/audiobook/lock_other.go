@@ -0,0 +1,11 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package audiobook
+
+import "os"
+
+// lockFile does nothing on platforms without file locking; concurrent runs
+// in the same work directory are not detected there.
+func lockFile(f *os.File) error {
+	return nil
+}
@@ -4,11 +4,66 @@ package audiobook
 const Schema = `{
   "$schema": "https://json-schema.org/draft/2020-12/schema",
   "title": "Audiobook Script",
-  "description": "A sequence of narration, sound effects, and silence blocks rendered into a single audio file.",
+  "description": "A sequence of narration, sound effects, local audio files and silence blocks rendered into a single audio file.",
   "type": "object",
   "required": ["blocks"],
   "additionalProperties": false,
   "properties": {
+    "crossfade": {
+      "type": "number",
+      "minimum": 0,
+      "default": 0,
+      "description": "Default overlap in seconds between consecutive sequential blocks."
+    },
+    "crossfade_curve": {
+      "$ref": "#/$defs/curve",
+      "description": "Default crossfade shape."
+    },
+    "ducking": {
+      "$ref": "#/$defs/ducking",
+      "description": "Duck every background layer under narration."
+    },
+    "trim_silence": {
+      "type": "boolean",
+      "default": false,
+      "description": "Strip leading and trailing silence from every TTS block before assembly."
+    },
+    "trim_threshold_db": {
+      "$ref": "#/$defs/trim_threshold_db"
+    },
+    "metadata": {
+      "type": "object",
+      "description": "Audiobook metadata, written to MP3 output as ID3 tags.",
+      "additionalProperties": false,
+      "properties": {
+        "title": {
+          "type": "string",
+          "description": "Book title, also written as the album."
+        },
+        "author": {
+          "type": "string",
+          "description": "Author, written as the artist."
+        },
+        "narrator": {
+          "type": "string",
+          "description": "Narrator, written as the composer."
+        },
+        "year": {
+          "type": "integer",
+          "minimum": 1000,
+          "maximum": 9999,
+          "description": "Year of publication."
+        },
+        "genre": {
+          "type": "string",
+          "description": "Genre, such as Audiobook."
+        },
+        "cover": {
+          "type": "string",
+          "description": "Path of a JPEG or PNG front cover image, relative to the script file."
+        }
+      }
+    },
     "blocks": {
       "type": "array",
       "minItems": 1,
@@ -19,12 +74,62 @@ const Schema = `{
         "oneOf": [
           { "$ref": "#/$defs/tts" },
           { "$ref": "#/$defs/sfx" },
+          { "$ref": "#/$defs/file" },
           { "$ref": "#/$defs/silence" }
         ]
       }
     }
   },
   "$defs": {
+    "trim_threshold_db": {
+      "type": "number",
+      "minimum": -90,
+      "maximum": 0,
+      "default": -50,
+      "description": "Level in dBFS below which audio counts as silence when trimming."
+    },
+    "ducking": {
+      "type": "object",
+      "description": "Turn a background layer down while TTS blocks are audible. Omitted fields fall back to the script's settings, then the defaults; an explicit 0 is kept.",
+      "additionalProperties": false,
+      "properties": {
+        "enabled": {
+          "type": "boolean",
+          "default": true,
+          "description": "Set to false on a background block to exempt it from the script's ducking."
+        },
+        "depth_db": {
+          "type": "number",
+          "minimum": 0,
+          "maximum": 60,
+          "default": 12,
+          "description": "Attenuation in dB while narration plays."
+        },
+        "threshold_db": {
+          "type": "number",
+          "minimum": -90,
+          "maximum": 0,
+          "default": -40,
+          "description": "Narration level in dBFS above which ducking engages."
+        },
+        "attack": {
+          "type": "number",
+          "minimum": 0,
+          "default": 0.05,
+          "description": "Seconds to reach full attenuation; ducking starts this early so the first syllable is clear."
+        },
+        "release": {
+          "type": "number",
+          "minimum": 0,
+          "default": 0.5,
+          "description": "Seconds to recover after narration stops."
+        }
+      }
+    },
+    "curve": {
+      "enum": ["linear", "equal-power"],
+      "default": "equal-power"
+    },
     "tts": {
       "type": "object",
       "description": "Text-to-speech narration block.",
@@ -32,6 +137,56 @@ const Schema = `{
       "additionalProperties": false,
       "properties": {
         "type": { "const": "tts" },
+        "id": {
+          "type": "string",
+          "minLength": 1,
+          "description": "Unique name background layers use to refer to this block."
+        },
+        "chapter": {
+          "type": "string",
+          "minLength": 1,
+          "description": "Start a chapter with this title at the block; it runs until the next chapter starts. Written to MP3 output as ID3 chapter frames. Not allowed on background layers."
+        },
+        "crossfade": {
+          "type": "number",
+          "minimum": 0,
+          "description": "Overlap in seconds with the previous sequential block, overriding the script's 'crossfade'. Not allowed on background layers."
+        },
+        "crossfade_curve": {
+          "$ref": "#/$defs/curve",
+          "description": "Shape of the crossfade into this block, overriding the script's 'crossfade_curve'."
+        },
+        "gain_db": {
+          "type": "number",
+          "minimum": -60,
+          "maximum": 24,
+          "default": 0,
+          "description": "Level change in decibels applied when the block is mixed (-60–24)."
+        },
+        "fade_in": {
+          "type": "number",
+          "minimum": 0,
+          "description": "Seconds over which the block fades in from silence."
+        },
+        "fade_out": {
+          "type": "number",
+          "minimum": 0,
+          "description": "Seconds over which the block fades out to silence. For a layer cut off by 'until' or 'span', the fade ends at the cut."
+        },
+        "pan": {
+          "type": "number",
+          "minimum": -1,
+          "maximum": 1,
+          "default": 0,
+          "description": "Stereo position from -1 (left) to 1 (right). Panning any block renders the audiobook in stereo."
+        },
+        "trim_silence": {
+          "type": "boolean",
+          "description": "Strip leading and trailing silence from this block, overriding the script's 'trim_silence'."
+        },
+        "trim_threshold_db": {
+          "$ref": "#/$defs/trim_threshold_db"
+        },
         "voice": {
           "type": "string",
           "description": "ElevenLabs voice ID."
@@ -64,11 +219,15 @@ const Schema = `{
           "maximum": 1,
           "description": "Style exaggeration (0.0–1.0)."
         },
+        "use_speaker_boost": {
+          "type": "boolean",
+          "description": "Boost similarity to the original speaker at the cost of latency."
+        },
         "speed": {
           "type": "number",
-          "minimum": 0.5,
-          "maximum": 2.0,
-          "description": "Playback speed multiplier (0.5–2.0)."
+          "minimum": 0.7,
+          "maximum": 1.2,
+          "description": "Speaking speed multiplier (0.7–1.2); 1.0 is the voice's natural pace."
         }
       }
     },
@@ -79,6 +238,57 @@ const Schema = `{
       "additionalProperties": false,
       "properties": {
         "type": { "const": "sfx" },
+        "id": {
+          "type": "string",
+          "minLength": 1,
+          "description": "Unique name background layers use to refer to this block."
+        },
+        "chapter": {
+          "type": "string",
+          "minLength": 1,
+          "description": "Start a chapter with this title at the block; it runs until the next chapter starts. Written to MP3 output as ID3 chapter frames. Not allowed on background layers."
+        },
+        "crossfade": {
+          "type": "number",
+          "minimum": 0,
+          "description": "Overlap in seconds with the previous sequential block, overriding the script's 'crossfade'. Not allowed on background layers."
+        },
+        "crossfade_curve": {
+          "$ref": "#/$defs/curve",
+          "description": "Shape of the crossfade into this block, overriding the script's 'crossfade_curve'."
+        },
+        "gain_db": {
+          "type": "number",
+          "minimum": -60,
+          "maximum": 24,
+          "default": 0,
+          "description": "Level change in decibels applied when the block is mixed (-60–24)."
+        },
+        "fade_in": {
+          "type": "number",
+          "minimum": 0,
+          "description": "Seconds over which the block fades in from silence."
+        },
+        "fade_out": {
+          "type": "number",
+          "minimum": 0,
+          "description": "Seconds over which the block fades out to silence. For a layer cut off by 'until' or 'span', the fade ends at the cut."
+        },
+        "pan": {
+          "type": "number",
+          "minimum": -1,
+          "maximum": 1,
+          "default": 0,
+          "description": "Stereo position from -1 (left) to 1 (right). Panning any block renders the audiobook in stereo."
+        },
+        "trim_silence": {
+          "type": "boolean",
+          "default": false,
+          "description": "Strip leading and trailing silence from this sound effect before assembly."
+        },
+        "trim_threshold_db": {
+          "$ref": "#/$defs/trim_threshold_db"
+        },
         "text": {
           "type": "string",
           "minLength": 1,
@@ -87,7 +297,40 @@ const Schema = `{
         "background": {
           "type": "boolean",
           "default": false,
-          "description": "When true, the SFX is mixed (overlaid) onto the next TTS block instead of playing sequentially."
+          "description": "When true, the SFX is layered under other blocks instead of playing sequentially. By default it starts with the next TTS block and extends that block if it is longer."
+        },
+        "ducking": {
+          "$ref": "#/$defs/ducking",
+          "description": "Background only: duck this layer under narration, overriding the script's 'ducking' settings."
+        },
+        "from": {
+          "type": "string",
+          "description": "Background only: id of the block the layer starts with. Defaults to the next TTS block."
+        },
+        "offset": {
+          "type": "number",
+          "minimum": 0,
+          "description": "Background only: seconds after the start of the 'from' block at which the layer starts."
+        },
+        "until": {
+          "type": "string",
+          "description": "Background only: id of the last block the layer plays under; the layer is cut off where that block ends."
+        },
+        "span": {
+          "type": "integer",
+          "minimum": 1,
+          "description": "Background only: number of sequential blocks, starting with the 'from' block, that the layer plays under. Cannot be combined with 'until'."
+        },
+        "loop": {
+          "type": "boolean",
+          "default": false,
+          "description": "Background only: repeat or cut the sound effect so it lasts exactly as long as the narration it plays under (the 'from' block, or through 'until' or 'span'), fading out at the end."
+        },
+        "loop_crossfade": {
+          "type": "number",
+          "minimum": 0,
+          "default": 1,
+          "description": "Seconds by which consecutive repeats of a looping layer overlap."
         },
         "duration": {
           "type": "number",
@@ -97,6 +340,109 @@ const Schema = `{
         }
       }
     },
+    "file": {
+      "type": "object",
+      "description": "Local WAV, MP3 or FLAC file, decoded and resampled to the mixing rate. In a stereo mix a stereo file keeps both channels and 'pan' balances them; otherwise the file is mixed down to mono by averaging its channels.",
+      "required": ["type", "path"],
+      "additionalProperties": false,
+      "properties": {
+        "type": { "const": "file" },
+        "id": {
+          "type": "string",
+          "minLength": 1,
+          "description": "Unique name background layers use to refer to this block."
+        },
+        "chapter": {
+          "type": "string",
+          "minLength": 1,
+          "description": "Start a chapter with this title at the block; it runs until the next chapter starts. Written to MP3 output as ID3 chapter frames. Not allowed on background layers."
+        },
+        "crossfade": {
+          "type": "number",
+          "minimum": 0,
+          "description": "Overlap in seconds with the previous sequential block, overriding the script's 'crossfade'. Not allowed on background layers."
+        },
+        "crossfade_curve": {
+          "$ref": "#/$defs/curve",
+          "description": "Shape of the crossfade into this block, overriding the script's 'crossfade_curve'."
+        },
+        "gain_db": {
+          "type": "number",
+          "minimum": -60,
+          "maximum": 24,
+          "default": 0,
+          "description": "Level change in decibels applied when the block is mixed (-60–24)."
+        },
+        "fade_in": {
+          "type": "number",
+          "minimum": 0,
+          "description": "Seconds over which the block fades in from silence."
+        },
+        "fade_out": {
+          "type": "number",
+          "minimum": 0,
+          "description": "Seconds over which the block fades out to silence. For a layer cut off by 'until' or 'span', the fade ends at the cut."
+        },
+        "pan": {
+          "type": "number",
+          "minimum": -1,
+          "maximum": 1,
+          "default": 0,
+          "description": "Stereo position from -1 (left) to 1 (right). Panning any block renders the audiobook in stereo."
+        },
+        "trim_silence": {
+          "type": "boolean",
+          "default": false,
+          "description": "Strip leading and trailing silence from this file before assembly."
+        },
+        "trim_threshold_db": {
+          "$ref": "#/$defs/trim_threshold_db"
+        },
+        "path": {
+          "type": "string",
+          "minLength": 1,
+          "description": "Path of the audio file. Relative paths are resolved against the directory of the script file."
+        },
+        "background": {
+          "type": "boolean",
+          "default": false,
+          "description": "When true, the file is layered under other blocks instead of playing sequentially. By default it starts with the next TTS block and extends that block if it is longer."
+        },
+        "ducking": {
+          "$ref": "#/$defs/ducking",
+          "description": "Background only: duck this layer under narration, overriding the script's 'ducking' settings."
+        },
+        "from": {
+          "type": "string",
+          "description": "Background only: id of the block the layer starts with. Defaults to the next TTS block."
+        },
+        "offset": {
+          "type": "number",
+          "minimum": 0,
+          "description": "Background only: seconds after the start of the 'from' block at which the layer starts."
+        },
+        "until": {
+          "type": "string",
+          "description": "Background only: id of the last block the layer plays under; the layer is cut off where that block ends."
+        },
+        "span": {
+          "type": "integer",
+          "minimum": 1,
+          "description": "Background only: number of sequential blocks, starting with the 'from' block, that the layer plays under. Cannot be combined with 'until'."
+        },
+        "loop": {
+          "type": "boolean",
+          "default": false,
+          "description": "Background only: repeat or cut the file so it lasts exactly as long as the narration it plays under (the 'from' block, or through 'until' or 'span'), fading out at the end."
+        },
+        "loop_crossfade": {
+          "type": "number",
+          "minimum": 0,
+          "default": 1,
+          "description": "Seconds by which consecutive repeats of a looping layer overlap."
+        }
+      }
+    },
     "silence": {
       "type": "object",
       "description": "Silent pause.",
@@ -104,6 +450,25 @@ const Schema = `{
       "additionalProperties": false,
       "properties": {
         "type": { "const": "silence" },
+        "id": {
+          "type": "string",
+          "minLength": 1,
+          "description": "Unique name background layers use to refer to this block."
+        },
+        "chapter": {
+          "type": "string",
+          "minLength": 1,
+          "description": "Start a chapter with this title at the block; it runs until the next chapter starts. Written to MP3 output as ID3 chapter frames. Not allowed on background layers."
+        },
+        "crossfade": {
+          "type": "number",
+          "minimum": 0,
+          "description": "Overlap in seconds with the previous sequential block, overriding the script's 'crossfade'. Not allowed on background layers."
+        },
+        "crossfade_curve": {
+          "$ref": "#/$defs/curve",
+          "description": "Shape of the crossfade into this block, overriding the script's 'crossfade_curve'."
+        },
         "duration": {
           "type": "number",
           "exclusiveMinimum": 0,
@@ -0,0 +1,74 @@
+package audiobook
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/deegital/elevencli/internal/audio"
+)
+
+// spool keeps the processed PCM of finished blocks in temporary files, so a
+// book is assembled from disk instead of being held in memory.
+type spool struct {
+	dir string
+
+	mu     sync.Mutex
+	blocks []audio.Source
+	// channels is the number of interleaved channels of each block.
+	channels []int
+}
+
+// spoolPattern names spool directories, so that ones left behind by a run
+// that was killed can be found and removed.
+const spoolPattern = "spool-*"
+
+// newSpool creates a spool for n blocks in a new directory inside parent,
+// or the system temporary directory if parent is empty.
+func newSpool(parent string, n int) (*spool, error) {
+	dir, err := os.MkdirTemp(parent, spoolPattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	return &spool{dir: dir, blocks: make([]audio.Source, n), channels: make([]int, n)}, nil
+}
+
+// put stores the PCM of block i, which has the given number of channels.
+func (s *spool) put(i int, pcm []byte, channels int) error {
+	path := filepath.Join(s.dir, fmt.Sprintf("block_%04d.pcm", i+1))
+	if err := os.WriteFile(path, pcm, 0600); err != nil {
+		return fmt.Errorf("failed to spool block: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocks[i] = spooledBlock{path: path, size: int64(len(pcm))}
+	s.channels[i] = channels
+	return nil
+}
+
+// Remove deletes the spooled blocks.
+func (s *spool) Remove() error {
+	return os.RemoveAll(s.dir)
+}
+
+// spooledBlock is the Source of a block in the spool. The file is opened
+// for every read, so a book with thousands of blocks does not hold a file
+// descriptor for each.
+type spooledBlock struct {
+	path string
+	size int64
+}
+
+func (b spooledBlock) Size() int64 {
+	return b.size
+}
+
+func (b spooledBlock) ReadAt(p []byte, off int64) (int, error) {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.ReadAt(p, off)
+}
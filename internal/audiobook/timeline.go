@@ -0,0 +1,273 @@
+package audiobook
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/deegital/elevencli/internal/audio"
+)
+
+// layer describes where a background block plays relative to the
+// sequential blocks of the script.
+type layer struct {
+	// block is the index of the background block.
+	block int
+	// anchor is the index of the sequential block the layer starts with,
+	// or -1 for a trailing layer that is appended after everything else.
+	anchor int
+	// last is the index of the last sequential block the layer plays
+	// under, or -1 if the layer plays to its natural length.
+	last int
+}
+
+// placement is the position of one block on the assembled timeline.
+type placement struct {
+	block int
+	start int
+	// length is the number of samples of the block that are used, or 0 to
+	// use all of it.
+	length int
+	// fades are the crossfades with neighbouring sequential blocks.
+	fades []audio.Fade
+}
+
+// isSequential reports whether a block plays in script order, as opposed
+// to being layered under other blocks.
+func isSequential(b *Block) bool {
+	return !b.IsBackground()
+}
+
+// planLayers resolves the from/until/span references of every background
+// block. A layer without 'from' starts with the next TTS block; if there is
+// none it is appended after all other blocks. A looping layer without
+// 'until' or 'span' ends with the block it starts with.
+func planLayers(s *Script) ([]layer, error) {
+	ids := map[string]int{}
+	for i, b := range s.Blocks {
+		if b.ID != "" {
+			ids[b.ID] = i
+		}
+	}
+	lookup := func(i int, field, id string) (int, error) {
+		j, ok := ids[id]
+		if !ok {
+			return 0, fmt.Errorf("block %d: '%s' refers to unknown block id %q", i, field, id)
+		}
+		if !isSequential(&s.Blocks[j]) {
+			return 0, fmt.Errorf("block %d: '%s' must refer to a sequential block, not background block %q", i, field, id)
+		}
+		return j, nil
+	}
+
+	var layers []layer
+	for i := range s.Blocks {
+		b := &s.Blocks[i]
+		if !b.IsBackground() {
+			continue
+		}
+		l := layer{block: i, anchor: -1, last: -1}
+
+		if b.From != "" {
+			j, err := lookup(i, "from", b.From)
+			if err != nil {
+				return nil, err
+			}
+			l.anchor = j
+		} else {
+			for j := i + 1; j < len(s.Blocks); j++ {
+				if s.Blocks[j].Type == "tts" {
+					l.anchor = j
+					break
+				}
+			}
+		}
+
+		switch {
+		case b.Until != "":
+			j, err := lookup(i, "until", b.Until)
+			if err != nil {
+				return nil, err
+			}
+			l.last = j
+		case b.Span > 0 && l.anchor >= 0:
+			n := 0
+			for j := l.anchor; j < len(s.Blocks) && n < b.Span; j++ {
+				if isSequential(&s.Blocks[j]) {
+					l.last = j
+					n++
+				}
+			}
+			if n < b.Span {
+				return nil, fmt.Errorf("block %d: 'span' of %d exceeds the %d sequential blocks after its start", i, b.Span, n)
+			}
+		}
+
+		if b.Loop && l.last < 0 {
+			if l.anchor < 0 {
+				return nil, fmt.Errorf("block %d: looping layer has no TTS block to play under; set 'from'", i)
+			}
+			l.last = l.anchor
+		}
+
+		if l.last >= 0 {
+			if l.anchor < 0 {
+				return nil, fmt.Errorf("block %d: background layer has no TTS block to start under; set 'from'", i)
+			}
+			if l.last < l.anchor {
+				return nil, fmt.Errorf("block %d: 'until' block %q comes before the layer's start", i, b.Until)
+			}
+		}
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+// arrange positions every block on the timeline given the length in
+// samples at sampleRate of each rendered block. Sequential blocks play back
+// to back, overlapping by their crossfade, which is limited to the length of
+// the shorter of the two. A layer with 'until' or 'span' starts at its
+// anchor plus 'offset' and is cut off where its last block ends; a looping
+// layer fills that range exactly. A layer without them plays to its natural
+// length and holds its anchor block open until it finishes. It returns the
+// placements and the total length.
+func arrange(s *Script, layers []layer, lengths []int, sampleRate int) ([]placement, int) {
+	hold := make([]int, len(s.Blocks))
+	for _, l := range layers {
+		if l.anchor >= 0 && l.last < 0 {
+			end := audio.Samples(s.Blocks[l.block].Offset, sampleRate) + lengths[l.block]
+			hold[l.anchor] = max(hold[l.anchor], end)
+		}
+	}
+
+	var placements []placement
+	starts := make([]int, len(s.Blocks))
+	spans := make([]int, len(s.Blocks))
+	cursor := 0
+	prev := -1 // index into placements of the previous sequential block
+	for i := range s.Blocks {
+		if !isSequential(&s.Blocks[i]) {
+			continue
+		}
+		spans[i] = max(lengths[i], hold[i])
+		p := placement{block: i, start: cursor}
+		if prev >= 0 {
+			seconds, curve := s.crossfade(i)
+			pb := placements[prev].block
+			overlap := min(audio.Samples(seconds, sampleRate), spans[pb], lengths[i])
+			if overlap > 0 {
+				p.start -= overlap
+				p.fades = append(p.fades, audio.Fade{Samples: overlap, Curve: curve})
+				// A block held open by a layer may end before the overlap
+				// does; fade out only the part of it that overlaps.
+				if tail := overlap - (spans[pb] - lengths[pb]); tail > 0 {
+					placements[prev].fades = append(placements[prev].fades,
+						audio.Fade{Out: true, Samples: tail, Curve: curve})
+				}
+			}
+		}
+		starts[i] = p.start
+		placements = append(placements, p)
+		prev = len(placements) - 1
+		cursor = p.start + spans[i]
+	}
+
+	for _, l := range layers {
+		if l.anchor < 0 {
+			placements = append(placements, placement{block: l.block, start: cursor})
+			cursor += lengths[l.block]
+			continue
+		}
+		p := placement{
+			block: l.block,
+			start: starts[l.anchor] + audio.Samples(s.Blocks[l.block].Offset, sampleRate),
+		}
+		if l.last >= 0 {
+			end := starts[l.last] + spans[l.last]
+			p.length = end - p.start
+			if !s.Blocks[l.block].Loop {
+				p.length = min(lengths[l.block], p.length)
+			}
+			if p.length <= 0 {
+				continue
+			}
+		}
+		placements = append(placements, p)
+	}
+
+	total := cursor
+	for _, p := range placements {
+		n := lengths[p.block]
+		if p.length > 0 {
+			n = p.length
+		}
+		total = max(total, p.start+n)
+	}
+	return placements, total
+}
+
+// assemble places the rendered blocks of script, 16-bit PCM at sampleRate
+// with blockChannels channels each, on a timeline that mixes them into the
+// given number of channels. It also returns the chapters of the script: each starts where
+// its block starts, crossfade included, and ends where the next begins.
+func assemble(s *Script, blocks []audio.Source, blockChannels []int, sampleRate, channels int) (*audio.Timeline, []audio.ID3Chapter, error) {
+	layers, err := planLayers(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	lengths := make([]int, len(blocks))
+	for i, b := range blocks {
+		lengths[i] = int(b.Size()) / (2 * blockChannels[i])
+	}
+	placements, total := arrange(s, layers, lengths, sampleRate)
+
+	at := func(sample int) time.Duration {
+		return time.Duration(int64(sample) * int64(time.Second) / int64(sampleRate))
+	}
+	var chapters []audio.ID3Chapter
+	for _, p := range placements {
+		title := s.Blocks[p.block].Chapter
+		if title == "" {
+			continue
+		}
+		if n := len(chapters); n > 0 {
+			chapters[n-1].End = at(p.start)
+		}
+		chapters = append(chapters, audio.ID3Chapter{Title: title, Start: at(p.start), End: at(total)})
+	}
+
+	tl := &audio.Timeline{SampleRate: sampleRate, Channels: channels}
+	for _, p := range placements {
+		b := &s.Blocks[p.block]
+		src := blocks[p.block]
+		fadeOut := b.FadeOut
+		if b.Loop {
+			xfade := defaultLoopCrossfade
+			if b.LoopCrossfade > 0 {
+				xfade = b.LoopCrossfade
+			}
+			src = audio.Loop(src, blockChannels[p.block], p.length, audio.Samples(xfade, sampleRate))
+			if fadeOut == 0 {
+				fadeOut = defaultLoopFadeOut
+			}
+		}
+		fades := p.fades
+		if b.FadeIn > 0 {
+			fades = append(fades, audio.Fade{Samples: audio.Samples(b.FadeIn, sampleRate)})
+		}
+		if fadeOut > 0 {
+			fades = append(fades, audio.Fade{Out: true, Samples: audio.Samples(fadeOut, sampleRate)})
+		}
+		tl.Add(audio.Clip{
+			Start:    p.start,
+			Source:   src,
+			Channels: blockChannels[p.block],
+			Length:   p.length,
+			GainDB:   b.GainDB,
+			Fades:    fades,
+			Key:      b.Type == "tts",
+			Duck:     s.ducking(p.block, sampleRate),
+			Pan:      b.Pan,
+		})
+	}
+	return tl, chapters, nil
+}
@@ -0,0 +1,278 @@
+package audiobook
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/deegital/elevencli/internal/audio"
+)
+
+// The tests use 100 samples per second, so that a length of 0.5 seconds is
+// 50 samples.
+const testRate = 100
+
+func tts(id string) Block {
+	return Block{Type: "tts", ID: id, Text: id}
+}
+
+func bg(b Block) Block {
+	b.Type = "sfx"
+	b.Background = true
+	return b
+}
+
+func seconds(v float64) *float64 {
+	return &v
+}
+
+func TestPlanLayers(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		blocks []Block
+		want   []layer
+		err    string
+	}{
+		{
+			name:   "next TTS block",
+			blocks: []Block{bg(Block{}), {Type: "silence"}, tts("a")},
+			want:   []layer{{block: 0, anchor: 2, last: -1}},
+		},
+		{
+			name:   "from",
+			blocks: []Block{tts("a"), tts("b"), bg(Block{From: "a"})},
+			want:   []layer{{block: 2, anchor: 0, last: -1}},
+		},
+		{
+			name:   "until",
+			blocks: []Block{bg(Block{Until: "c"}), tts("a"), {Type: "silence", ID: "s"}, tts("c")},
+			want:   []layer{{block: 0, anchor: 1, last: 3}},
+		},
+		{
+			name:   "span counts sequential blocks",
+			blocks: []Block{tts("a"), bg(Block{From: "a", Span: 3}), {Type: "silence"}, tts("b")},
+			want:   []layer{{block: 1, anchor: 0, last: 3}},
+		},
+		{
+			name:   "loop ends with its anchor",
+			blocks: []Block{bg(Block{Loop: true}), tts("a"), tts("b")},
+			want:   []layer{{block: 0, anchor: 1, last: 1}},
+		},
+		{
+			name:   "trailing",
+			blocks: []Block{tts("a"), bg(Block{})},
+			want:   []layer{{block: 1, anchor: -1, last: -1}},
+		},
+		{
+			name:   "unknown id",
+			blocks: []Block{bg(Block{From: "x"}), tts("a")},
+			err:    `'from' refers to unknown block id "x"`,
+		},
+		{
+			name:   "background reference",
+			blocks: []Block{bg(Block{ID: "m"}), bg(Block{Until: "m"}), tts("a")},
+			err:    "must refer to a sequential block",
+		},
+		{
+			name:   "span too long",
+			blocks: []Block{tts("a"), bg(Block{From: "a", Span: 3}), tts("b")},
+			err:    "'span' of 3 exceeds the 2 sequential blocks",
+		},
+		{
+			name:   "until before from",
+			blocks: []Block{tts("a"), tts("b"), bg(Block{From: "b", Until: "a"})},
+			err:    "comes before the layer's start",
+		},
+		{
+			name:   "trailing loop",
+			blocks: []Block{tts("a"), bg(Block{Loop: true})},
+			err:    "looping layer has no TTS block",
+		},
+		{
+			name:   "trailing until",
+			blocks: []Block{tts("a"), bg(Block{Until: "a"})},
+			err:    "has no TTS block to start under",
+		},
+	} {
+		got, err := planLayers(&Script{Blocks: tt.blocks})
+		switch {
+		case tt.err != "":
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case !reflect.DeepEqual(got, tt.want):
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestArrange(t *testing.T) {
+	in := func(n int, c audio.Curve) audio.Fade { return audio.Fade{Samples: n, Curve: c} }
+	out := func(n int, c audio.Curve) audio.Fade { return audio.Fade{Out: true, Samples: n, Curve: c} }
+	fades := func(f ...audio.Fade) []audio.Fade { return f }
+
+	for _, tt := range []struct {
+		name    string
+		script  Script
+		lengths []int
+		want    []placement
+		total   int
+	}{
+		{
+			name:    "sequence",
+			script:  Script{Blocks: []Block{tts("a"), {Type: "silence"}, tts("b")}},
+			lengths: []int{100, 50, 200},
+			want:    []placement{{block: 0}, {block: 1, start: 100}, {block: 2, start: 150}},
+			total:   350,
+		},
+		{
+			name:    "crossfade",
+			script:  Script{Crossfade: 0.5, Blocks: []Block{tts("a"), tts("b")}},
+			lengths: []int{100, 200},
+			want: []placement{
+				{block: 0, fades: fades(out(50, audio.EqualPower))},
+				{block: 1, start: 50, fades: fades(in(50, audio.EqualPower))},
+			},
+			total: 250,
+		},
+		{
+			name:    "crossfade limited to the shorter block",
+			script:  Script{Crossfade: 0.5, Blocks: []Block{tts("a"), tts("b")}},
+			lengths: []int{30, 200},
+			want: []placement{
+				{block: 0, fades: fades(out(30, audio.EqualPower))},
+				{block: 1, fades: fades(in(30, audio.EqualPower))},
+			},
+			total: 200,
+		},
+		{
+			name: "block crossfade overrides",
+			script: Script{Crossfade: 0.5, Blocks: []Block{
+				tts("a"),
+				{Type: "tts", ID: "b", Crossfade: seconds(0.2), CrossfadeCurve: "linear"},
+				{Type: "tts", ID: "c", Crossfade: seconds(0)},
+			}},
+			lengths: []int{100, 100, 100},
+			want: []placement{
+				{block: 0, fades: fades(out(20, audio.Linear))},
+				{block: 1, start: 80, fades: fades(in(20, audio.Linear))},
+				{block: 2, start: 180},
+			},
+			total: 280,
+		},
+		{
+			name:    "anchor hold",
+			script:  Script{Blocks: []Block{bg(Block{}), tts("a"), tts("b")}},
+			lengths: []int{300, 100, 100},
+			want:    []placement{{block: 1}, {block: 2, start: 300}, {block: 0}},
+			total:   400,
+		},
+		{
+			name:    "anchor hold with offset",
+			script:  Script{Blocks: []Block{bg(Block{Offset: 0.5}), tts("a"), tts("b")}},
+			lengths: []int{100, 100, 100},
+			want:    []placement{{block: 1}, {block: 2, start: 150}, {block: 0, start: 50}},
+			total:   250,
+		},
+		{
+			name:    "crossfade out of a held block fades only its tail",
+			script:  Script{Crossfade: 0.5, Blocks: []Block{bg(Block{}), tts("a"), tts("b")}},
+			lengths: []int{120, 100, 100},
+			want: []placement{
+				{block: 1, fades: fades(out(30, audio.EqualPower))},
+				{block: 2, start: 70, fades: fades(in(50, audio.EqualPower))},
+				{block: 0},
+			},
+			total: 170,
+		},
+		{
+			name:    "crossfade out of a block held past the overlap",
+			script:  Script{Crossfade: 0.5, Blocks: []Block{bg(Block{}), tts("a"), tts("b")}},
+			lengths: []int{200, 100, 100},
+			want: []placement{
+				{block: 1},
+				{block: 2, start: 150, fades: fades(in(50, audio.EqualPower))},
+				{block: 0},
+			},
+			total: 250,
+		},
+		{
+			name: "span",
+			script: Script{Blocks: []Block{
+				tts("a"), tts("b"), tts("c"),
+				bg(Block{From: "a", Span: 2}),
+				bg(Block{From: "a", Span: 2}),
+				bg(Block{From: "b", Span: 2, Loop: true}),
+			}},
+			lengths: []int{100, 100, 100, 500, 50, 30},
+			want: []placement{
+				{block: 0}, {block: 1, start: 100}, {block: 2, start: 200},
+				{block: 3, length: 200},
+				{block: 4, length: 50},
+				{block: 5, start: 100, length: 200},
+			},
+			total: 300,
+		},
+		{
+			name: "until with offset",
+			script: Script{Blocks: []Block{
+				tts("a"), tts("b"),
+				bg(Block{From: "a", Until: "b", Offset: 0.5, Loop: true}),
+			}},
+			lengths: []int{100, 100, 30},
+			want:    []placement{{block: 0}, {block: 1, start: 100}, {block: 2, start: 50, length: 150}},
+			total:   200,
+		},
+		{
+			name: "until across crossfades",
+			script: Script{Crossfade: 0.5, Blocks: []Block{
+				tts("a"), tts("b"), tts("c"),
+				bg(Block{From: "a", Until: "b", Loop: true}),
+			}},
+			lengths: []int{100, 100, 100, 30},
+			want: []placement{
+				{block: 0, fades: fades(out(50, audio.EqualPower))},
+				{block: 1, start: 50, fades: fades(in(50, audio.EqualPower), out(50, audio.EqualPower))},
+				{block: 2, start: 100, fades: fades(in(50, audio.EqualPower))},
+				{block: 3, length: 150},
+			},
+			total: 200,
+		},
+		{
+			name:    "loop fills its anchor",
+			script:  Script{Blocks: []Block{bg(Block{Loop: true}), tts("a"), tts("b")}},
+			lengths: []int{30, 100, 100},
+			want:    []placement{{block: 1}, {block: 2, start: 100}, {block: 0, length: 100}},
+			total:   200,
+		},
+		{
+			name:    "layer starting after its range",
+			script:  Script{Blocks: []Block{tts("a"), bg(Block{From: "a", Until: "a", Offset: 2})}},
+			lengths: []int{100, 50},
+			want:    []placement{{block: 0}},
+			total:   100,
+		},
+		{
+			name:    "trailing layers",
+			script:  Script{Blocks: []Block{tts("a"), bg(Block{}), bg(Block{})}},
+			lengths: []int{100, 80, 20},
+			want:    []placement{{block: 0}, {block: 1, start: 100}, {block: 2, start: 180}},
+			total:   200,
+		},
+	} {
+		layers, err := planLayers(&tt.script)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got, total := arrange(&tt.script, layers, tt.lengths, testRate)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+		if total != tt.total {
+			t.Errorf("%s: total %d, want %d", tt.name, total, tt.total)
+		}
+	}
+}
@@ -1,40 +1,484 @@
 package audiobook
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/deegital/elevencli/internal/audio"
+	"github.com/deegital/elevencli/internal/elevenlabs"
+)
+
+// DefaultModel is the TTS model used when a block does not name one.
+const DefaultModel = "eleven_multilingual_v2"
+
+// Limits for a block's gain_db.
+const (
+	minGainDB = -60
+	maxGainDB = 24
+)
 
 // Script represents an audiobook script containing a sequence of blocks.
 type Script struct {
-	Blocks []Block `json:"blocks"`
+	// Crossfade is the default overlap in seconds between consecutive
+	// sequential blocks. Blocks can override it.
+	Crossfade float64 `json:"crossfade,omitempty"`
+	// CrossfadeCurve is the default crossfade shape: "linear" or
+	// "equal-power" (the default).
+	CrossfadeCurve string `json:"crossfade_curve,omitempty"`
+	// Ducking, when set, ducks every background layer under narration.
+	Ducking *Ducking `json:"ducking,omitempty"`
+	// TrimSilence strips leading and trailing silence from every TTS block
+	// before assembly, so gaps come only from the script. Blocks can
+	// override it.
+	TrimSilence bool `json:"trim_silence,omitempty"`
+	// TrimThresholdDB is the level in dBFS below which audio counts as
+	// silence when trimming. Defaults to -50.
+	TrimThresholdDB float64 `json:"trim_threshold_db,omitempty"`
+	// Metadata is written as ID3 tags into MP3 output.
+	Metadata *Metadata `json:"metadata,omitempty"`
+	Blocks   []Block   `json:"blocks"`
+
+	// Dir is the directory relative paths of file blocks and the cover
+	// image are resolved against, usually the one holding the script file. Empty means the
+	// working directory.
+	Dir string `json:"-"`
+}
+
+// Metadata describes the audiobook to players. All fields are optional.
+type Metadata struct {
+	Title    string `json:"title,omitempty"`
+	Author   string `json:"author,omitempty"`
+	Narrator string `json:"narrator,omitempty"`
+	Year     int    `json:"year,omitempty"`
+	Genre    string `json:"genre,omitempty"`
+	// Cover is the path of a JPEG or PNG front cover image.
+	Cover string `json:"cover,omitempty"`
+}
+
+// Ducking configures how far and how fast a background layer is turned down
+// while TTS blocks are audible. On a block, fields left out fall back to the
+// script's ducking settings and then to the defaults; an explicit 0 is kept.
+type Ducking struct {
+	// Enabled, set to false on a background block, turns off the ducking
+	// the script applies to every layer. Defaults to true.
+	Enabled *bool `json:"enabled,omitempty"`
+	// DepthDB is the attenuation in dB. Defaults to 12.
+	DepthDB *float64 `json:"depth_db,omitempty"`
+	// ThresholdDB is the narration level in dBFS above which ducking
+	// engages. Defaults to -40.
+	ThresholdDB *float64 `json:"threshold_db,omitempty"`
+	// Attack and Release are the times in seconds to reach full depth and to
+	// recover. Default to 0.05 and 0.5.
+	Attack  *float64 `json:"attack,omitempty"`
+	Release *float64 `json:"release,omitempty"`
+}
+
+// Defaults for looping background layers: the overlap between repeats and
+// the fade-out used when the block does not set fade_out.
+const (
+	defaultLoopCrossfade = 1.0
+	defaultLoopFadeOut   = 1.0
+)
+
+// defaultTrimThreshold is the default trim_threshold_db.
+const defaultTrimThreshold = -50
+
+// Default ducking settings.
+const (
+	defaultDuckDepth     = 12
+	defaultDuckThreshold = -40
+	defaultDuckAttack    = 0.05
+	defaultDuckRelease   = 0.5
+)
+
+func (d *Ducking) validate() error {
+	if d.DepthDB != nil && (*d.DepthDB < 0 || *d.DepthDB > 60) {
+		return fmt.Errorf("'ducking.depth_db' must be between 0 and 60")
+	}
+	if d.ThresholdDB != nil && (*d.ThresholdDB < -90 || *d.ThresholdDB > 0) {
+		return fmt.Errorf("'ducking.threshold_db' must be between -90 and 0")
+	}
+	if d.Attack != nil && *d.Attack < 0 || d.Release != nil && *d.Release < 0 {
+		return fmt.Errorf("'ducking.attack' and 'ducking.release' must not be negative")
+	}
+	return nil
 }
 
 // Block represents a single segment in the audiobook script.
 type Block struct {
-	Type            string  `json:"type"`
-	Voice           string  `json:"voice,omitempty"`
-	Text            string  `json:"text,omitempty"`
-	Model           string  `json:"model,omitempty"`
-	Stability       float32 `json:"stability,omitempty"`
-	SimilarityBoost float32 `json:"similarity_boost,omitempty"`
-	Style           float32 `json:"style,omitempty"`
-	Speed           float64 `json:"speed,omitempty"`
-	Background      bool    `json:"background,omitempty"`
-	Duration        float64 `json:"duration,omitempty"`
-}
-
-// Validate checks the script for structural correctness.
+	Type            string   `json:"type"`
+	Voice           string   `json:"voice,omitempty"`
+	Text            string   `json:"text,omitempty"`
+	Model           string   `json:"model,omitempty"`
+	Stability       *float64 `json:"stability,omitempty"`
+	SimilarityBoost *float64 `json:"similarity_boost,omitempty"`
+	Style           *float64 `json:"style,omitempty"`
+	UseSpeakerBoost *bool    `json:"use_speaker_boost,omitempty"`
+	Speed           *float64 `json:"speed,omitempty"`
+	Background      bool     `json:"background,omitempty"`
+	Duration        float64  `json:"duration,omitempty"`
+
+	// Path is the WAV, MP3 or FLAC file a file block plays.
+	Path string `json:"path,omitempty"`
+
+	// GainDB changes the block's level in the mix by this many decibels.
+	GainDB float64 `json:"gain_db,omitempty"`
+	// FadeIn and FadeOut are the lengths in seconds of linear ramps from and
+	// to silence at the start and end of the block.
+	FadeIn  float64 `json:"fade_in,omitempty"`
+	FadeOut float64 `json:"fade_out,omitempty"`
+	// Pan places the block in a stereo mix, from -1 (left) to 1 (right).
+	Pan float64 `json:"pan,omitempty"`
+
+	// Crossfade overrides the script's crossfade into this block from the
+	// previous sequential block; an explicit 0 butts the two together.
+	Crossfade      *float64 `json:"crossfade,omitempty"`
+	CrossfadeCurve string   `json:"crossfade_curve,omitempty"`
+
+	// Ducking, on a background block, turns the layer down while narration
+	// plays, overriding the script's ducking settings.
+	Ducking *Ducking `json:"ducking,omitempty"`
+
+	// TrimSilence overrides the script's trim_silence for this block; on an
+	// sfx or file block it enables trimming, which otherwise only applies to
+	// TTS.
+	TrimSilence     *bool   `json:"trim_silence,omitempty"`
+	TrimThresholdDB float64 `json:"trim_threshold_db,omitempty"`
+
+	// Chapter starts a chapter with this title at the block. The chapter
+	// runs until the next one starts, or to the end.
+	Chapter string `json:"chapter,omitempty"`
+
+	// ID names the block so background layers can refer to it.
+	ID string `json:"id,omitempty"`
+	// From is the ID of the block a background layer starts with. Defaults
+	// to the next TTS block after the layer.
+	From string `json:"from,omitempty"`
+	// Offset delays a background layer by this many seconds after the
+	// start of its From block.
+	Offset float64 `json:"offset,omitempty"`
+	// Until is the ID of the last block a background layer plays under;
+	// the layer is cut off where that block ends.
+	Until string `json:"until,omitempty"`
+	// Span is an alternative to Until: the number of sequential blocks,
+	// starting with the From block, that a background layer plays under.
+	Span int `json:"span,omitempty"`
+	// Loop makes a background layer last exactly as long as the narration
+	// it plays under: its From block, or through Until or Span. A shorter
+	// sound is repeated, a longer one is cut, and the layer fades out at the
+	// end.
+	Loop bool `json:"loop,omitempty"`
+	// LoopCrossfade is the overlap in seconds between repeats of a looping
+	// layer. Defaults to 1.
+	LoopCrossfade float64 `json:"loop_crossfade,omitempty"`
+}
+
+// Panned reports whether any block of the script is panned away from the
+// centre, which needs a stereo mix.
+func (s *Script) Panned() bool {
+	for _, b := range s.Blocks {
+		if b.Pan != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBackground reports whether the block is mixed under other blocks rather
+// than played in sequence.
+func (b *Block) IsBackground() bool {
+	return (b.Type == "sfx" || b.Type == "file") && b.Background
+}
+
+// filePath returns the path of the audio file of a file block.
+func (s *Script) filePath(b *Block) string {
+	return s.resolve(b.Path)
+}
+
+// resolve returns path relative to the script's directory.
+func (s *Script) resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(s.Dir, path)
+}
+
+// Chapters returns the number of blocks that start a chapter.
+func (s *Script) Chapters() int {
+	n := 0
+	for _, b := range s.Blocks {
+		if b.Chapter != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// VoiceSettings returns the voice settings a TTS block overrides. Fields the
+// script leaves out stay nil, so an explicit 0 is still sent.
+func (b *Block) VoiceSettings() elevenlabs.VoiceSettings {
+	return elevenlabs.VoiceSettings{
+		Stability:       b.Stability,
+		SimilarityBoost: b.SimilarityBoost,
+		Style:           b.Style,
+		UseSpeakerBoost: b.UseSpeakerBoost,
+		Speed:           b.Speed,
+	}
+}
+
+// crossfade returns the crossfade length in seconds and curve into block i.
+func (s *Script) crossfade(i int) (float64, audio.Curve) {
+	b := &s.Blocks[i]
+	length := s.Crossfade
+	if b.Crossfade != nil {
+		length = *b.Crossfade
+	}
+	name := s.CrossfadeCurve
+	if b.CrossfadeCurve != "" {
+		name = b.CrossfadeCurve
+	}
+	curve, _ := parseCurve(name)
+	return length, curve
+}
+
+// trim reports whether block i has its leading and trailing silence
+// removed, and below which level in dBFS audio counts as silence.
+func (s *Script) trim(i int) (bool, float64) {
+	b := &s.Blocks[i]
+	enabled := s.TrimSilence && b.Type == "tts"
+	if b.TrimSilence != nil {
+		enabled = *b.TrimSilence
+	}
+	threshold := float64(defaultTrimThreshold)
+	if s.TrimThresholdDB != 0 {
+		threshold = s.TrimThresholdDB
+	}
+	if b.TrimThresholdDB != 0 {
+		threshold = b.TrimThresholdDB
+	}
+	return enabled, threshold
+}
+
+// validateTrimThreshold checks a trim_threshold_db value; 0 means unset.
+func validateTrimThreshold(db float64) error {
+	if db < -90 || db > 0 {
+		return fmt.Errorf("'trim_threshold_db' must be between -90 and 0")
+	}
+	return nil
+}
+
+// ducking returns the ducking applied to background block i when mixing at
+// sampleRate, or nil if neither the block nor the script enables it.
+func (s *Script) ducking(i, sampleRate int) *audio.Ducking {
+	b := &s.Blocks[i]
+	if !b.IsBackground() || (b.Ducking == nil && s.Ducking == nil) {
+		return nil
+	}
+	enabled := true
+	d := audio.Ducking{
+		Depth:     defaultDuckDepth,
+		Threshold: defaultDuckThreshold,
+	}
+	attack, release := defaultDuckAttack, defaultDuckRelease
+	// The block's settings override the script's, field by field.
+	for _, o := range []*Ducking{s.Ducking, b.Ducking} {
+		if o == nil {
+			continue
+		}
+		if o.Enabled != nil {
+			enabled = *o.Enabled
+		}
+		if o.DepthDB != nil {
+			d.Depth = *o.DepthDB
+		}
+		if o.ThresholdDB != nil {
+			d.Threshold = *o.ThresholdDB
+		}
+		if o.Attack != nil {
+			attack = *o.Attack
+		}
+		if o.Release != nil {
+			release = *o.Release
+		}
+	}
+	if !enabled {
+		return nil
+	}
+	d.Attack = audio.Samples(attack, sampleRate)
+	d.Release = audio.Samples(release, sampleRate)
+	return &d
+}
+
+// parseCurve maps a crossfade_curve value to a fade curve. Equal-power is the
+// default because adjacent blocks are usually unrelated sounds.
+func parseCurve(name string) (audio.Curve, error) {
+	switch name {
+	case "", "equal-power":
+		return audio.EqualPower, nil
+	case "linear":
+		return audio.Linear, nil
+	}
+	return 0, fmt.Errorf("unknown crossfade_curve %q (supported: linear, equal-power)", name)
+}
+
+// Validate checks the script for structural correctness, that the audio
+// files of file blocks exist and that the cover is a JPEG or PNG image.
 func (s *Script) Validate() error {
 	if len(s.Blocks) == 0 {
 		return fmt.Errorf("script has no blocks")
 	}
+	if s.Crossfade < 0 {
+		return fmt.Errorf("'crossfade' must not be negative")
+	}
+	if _, err := parseCurve(s.CrossfadeCurve); err != nil {
+		return err
+	}
+	if s.Ducking != nil {
+		if err := s.Ducking.validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateTrimThreshold(s.TrimThresholdDB); err != nil {
+		return err
+	}
+	if s.Metadata != nil {
+		if err := s.Metadata.validate(s); err != nil {
+			return err
+		}
+	}
+	if n := s.Chapters(); n > audio.MaxID3Chapters {
+		return fmt.Errorf("script has %d chapters; at most %d are supported", n, audio.MaxID3Chapters)
+	}
+	ids := map[string]int{}
 	for i, b := range s.Blocks {
 		if err := b.validate(); err != nil {
 			return fmt.Errorf("block %d: %w", i, err)
 		}
+		if b.Type == "file" {
+			path := s.filePath(&b)
+			info, err := os.Stat(path)
+			if err == nil && !info.Mode().IsRegular() {
+				err = fmt.Errorf("%s is not a regular file", path)
+			}
+			if err != nil {
+				return fmt.Errorf("block %d: %w", i, err)
+			}
+		}
+		if b.ID != "" {
+			if prev, ok := ids[b.ID]; ok {
+				return fmt.Errorf("block %d: id %q is already used by block %d", i, b.ID, prev)
+			}
+			ids[b.ID] = i
+		}
+	}
+	if _, err := planLayers(s); err != nil {
+		return err
+	}
+	return nil
+}
+
+// tag returns the ID3 tag for the script's metadata with the cover image
+// read in, or nil if the script has none.
+func (s *Script) tag() (*audio.ID3Tag, error) {
+	m := s.Metadata
+	if m == nil {
+		return nil, nil
+	}
+	t := &audio.ID3Tag{
+		Title: m.Title,
+		// Players group tracks by album, so the book is its own album.
+		Album:    m.Title,
+		Artist:   m.Author,
+		Composer: m.Narrator,
+		Genre:    m.Genre,
+	}
+	if m.Year != 0 {
+		t.Year = strconv.Itoa(m.Year)
+	}
+	if m.Cover != "" {
+		cover, err := os.ReadFile(s.resolve(m.Cover))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cover: %w", err)
+		}
+		t.Cover = cover
+	}
+	return t, nil
+}
+
+func (m *Metadata) validate(s *Script) error {
+	if m.Year != 0 && (m.Year < 1000 || m.Year > 9999) {
+		return fmt.Errorf("'metadata.year' must be a four-digit year")
+	}
+	if m.Cover != "" {
+		data, err := os.ReadFile(s.resolve(m.Cover))
+		if err == nil {
+			_, err = audio.CoverMIME(data)
+		}
+		if err != nil {
+			return fmt.Errorf("'metadata.cover': %w", err)
+		}
 	}
 	return nil
 }
 
 func (b *Block) validate() error {
+	if !b.IsBackground() && (b.From != "" || b.Offset != 0 || b.Until != "" || b.Span != 0 || b.Loop) {
+		return fmt.Errorf("'from', 'offset', 'until', 'span' and 'loop' only apply to background sfx and file blocks")
+	}
+	if b.LoopCrossfade < 0 {
+		return fmt.Errorf("'loop_crossfade' must not be negative")
+	}
+	if b.LoopCrossfade != 0 && !b.Loop {
+		return fmt.Errorf("'loop_crossfade' requires 'loop'")
+	}
+	if b.Offset < 0 {
+		return fmt.Errorf("'offset' must not be negative")
+	}
+	if b.Span < 0 {
+		return fmt.Errorf("'span' must not be negative")
+	}
+	if b.Until != "" && b.Span != 0 {
+		return fmt.Errorf("'until' and 'span' cannot be combined")
+	}
+	if b.GainDB < minGainDB || b.GainDB > maxGainDB {
+		return fmt.Errorf("'gain_db' must be between %g and %g", float64(minGainDB), float64(maxGainDB))
+	}
+	if b.FadeIn < 0 || b.FadeOut < 0 {
+		return fmt.Errorf("'fade_in' and 'fade_out' must not be negative")
+	}
+	if b.Pan < -1 || b.Pan > 1 {
+		return fmt.Errorf("'pan' must be between -1 and 1")
+	}
+	if b.IsBackground() && (b.Crossfade != nil || b.CrossfadeCurve != "") {
+		return fmt.Errorf("'crossfade' only applies to sequential blocks; use 'fade_in' and 'fade_out' on background layers")
+	}
+	if b.Crossfade != nil && *b.Crossfade < 0 {
+		return fmt.Errorf("'crossfade' must not be negative")
+	}
+	if _, err := parseCurve(b.CrossfadeCurve); err != nil {
+		return err
+	}
+	if err := validateTrimThreshold(b.TrimThresholdDB); err != nil {
+		return err
+	}
+	if b.Ducking != nil {
+		if !b.IsBackground() {
+			return fmt.Errorf("'ducking' only applies to background sfx and file blocks")
+		}
+		if err := b.Ducking.validate(); err != nil {
+			return err
+		}
+	}
+
+	if b.Chapter != "" && b.IsBackground() {
+		return fmt.Errorf("'chapter' only applies to sequential blocks")
+	}
+	if b.Path != "" && b.Type != "file" {
+		return fmt.Errorf("'path' only applies to file blocks")
+	}
+
 	switch b.Type {
 	case "tts":
 		if b.Voice == "" {
@@ -43,17 +487,8 @@ func (b *Block) validate() error {
 		if b.Text == "" {
 			return fmt.Errorf("tts block requires 'text'")
 		}
-		if b.Stability < 0 || b.Stability > 1 {
-			return fmt.Errorf("tts 'stability' must be between 0.0 and 1.0")
-		}
-		if b.SimilarityBoost < 0 || b.SimilarityBoost > 1 {
-			return fmt.Errorf("tts 'similarity_boost' must be between 0.0 and 1.0")
-		}
-		if b.Style < 0 || b.Style > 1 {
-			return fmt.Errorf("tts 'style' must be between 0.0 and 1.0")
-		}
-		if b.Speed != 0 && (b.Speed < 0.5 || b.Speed > 2.0) {
-			return fmt.Errorf("tts 'speed' must be between 0.5 and 2.0")
+		if err := b.VoiceSettings().Validate(); err != nil {
+			return fmt.Errorf("tts %w", err)
 		}
 	case "sfx":
 		if b.Text == "" {
@@ -62,10 +497,23 @@ func (b *Block) validate() error {
 		if b.Duration != 0 && (b.Duration < 0.5 || b.Duration > 22) {
 			return fmt.Errorf("sfx 'duration' must be between 0.5 and 22.0 seconds")
 		}
+	case "file":
+		if b.Path == "" {
+			return fmt.Errorf("file block requires 'path'")
+		}
+		if b.Text != "" || b.Voice != "" || b.Duration != 0 {
+			return fmt.Errorf("file block does not take 'text', 'voice' or 'duration'")
+		}
 	case "silence":
 		if b.Duration <= 0 {
 			return fmt.Errorf("silence block requires positive 'duration'")
 		}
+		if b.GainDB != 0 || b.FadeIn != 0 || b.FadeOut != 0 || b.Pan != 0 {
+			return fmt.Errorf("silence block does not take 'gain_db', 'fade_in', 'fade_out' or 'pan'")
+		}
+		if b.TrimSilence != nil || b.TrimThresholdDB != 0 {
+			return fmt.Errorf("silence block does not take 'trim_silence' or 'trim_threshold_db'")
+		}
 	default:
 		return fmt.Errorf("unknown block type %q", b.Type)
 	}
@@ -0,0 +1,267 @@
+package audiobook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/deegital/elevencli/internal/atomicfile"
+)
+
+const (
+	manifestName    = "manifest.json"
+	manifestVersion = 1
+	lockName        = "lock"
+)
+
+// errLocked is returned by lockFile when another process holds the lock.
+var errLocked = errors.New("locked")
+
+// Manifest records the progress of a render in a work directory.
+type Manifest struct {
+	Version int             `json:"version"`
+	Blocks  []ManifestBlock `json:"blocks"`
+}
+
+// ManifestBlock is the state of one script block in a run.
+type ManifestBlock struct {
+	// Key identifies the block's rendering inputs; a resumed run only reuses
+	// the block if the script still produces the same key.
+	Key  string `json:"key"`
+	Done bool   `json:"done"`
+	File string `json:"file,omitempty"`
+}
+
+// WorkDir persists every finished block and a run manifest so that a failed
+// or interrupted render can continue where it stopped.
+type WorkDir struct {
+	dir string
+	// lock is held open for as long as the run uses the directory.
+	lock *os.File
+
+	mu       sync.Mutex
+	manifest Manifest
+}
+
+// OpenWorkDir prepares dir for rendering script in the API output format
+// format. With resume set, blocks recorded as finished by a previous run are
+// kept when their inputs are unchanged; otherwise any previous progress is
+// discarded. The directory is locked until Close or Remove, so a second run
+// cannot use it at the same time.
+func OpenWorkDir(dir string, script *Script, format string, resume bool) (*WorkDir, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create work directory: %w", err)
+	}
+	lock, err := os.OpenFile(filepath.Join(dir, lockName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock work directory: %w", err)
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		if errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("work directory %s is in use by another run", dir)
+		}
+		return nil, fmt.Errorf("failed to lock work directory: %w", err)
+	}
+
+	w, err := openWorkDir(dir, script, format, resume)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	w.lock = lock
+	return w, nil
+}
+
+// openWorkDir sets up the manifest of a work directory the caller has
+// locked.
+func openWorkDir(dir string, script *Script, format string, resume bool) (*WorkDir, error) {
+	prev, manifest, err := planManifest(dir, script, format, resume)
+	if err != nil {
+		return nil, err
+	}
+	w := &WorkDir{dir: dir, manifest: manifest}
+
+	// Any spool already here was left behind by a run that was killed
+	// before it could clean up; a live run would hold the lock.
+	stale, _ := filepath.Glob(filepath.Join(dir, spoolPattern))
+	for _, path := range stale {
+		_ = os.RemoveAll(path)
+	}
+
+	// Drop block files that the new manifest no longer references.
+	for i := range prev.Blocks {
+		if prev.Blocks[i].File == "" {
+			continue
+		}
+		if i < len(w.manifest.Blocks) && w.manifest.Blocks[i].File == prev.Blocks[i].File {
+			continue
+		}
+		_ = os.Remove(filepath.Join(dir, prev.Blocks[i].File))
+	}
+
+	if err := w.writeManifest(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// ReadWorkDir returns the progress a run resumed in dir would start from,
+// without creating, locking or changing anything there, so that an estimate
+// can leave out the blocks it would not render again. Only Has, Done and
+// Load may be used on the result.
+func ReadWorkDir(dir string, script *Script, format string) (*WorkDir, error) {
+	_, manifest, err := planManifest(dir, script, format, true)
+	if err != nil {
+		return nil, err
+	}
+	return &WorkDir{dir: dir, manifest: manifest}, nil
+}
+
+// planManifest returns the manifest a previous run left in dir, if resume
+// is set, and the manifest for rendering script, which keeps the finished
+// blocks of the previous one whose inputs are unchanged.
+func planManifest(dir string, script *Script, format string, resume bool) (prev, next Manifest, err error) {
+	if resume {
+		data, err := os.ReadFile(filepath.Join(dir, manifestName))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return prev, next, fmt.Errorf("nothing to resume: no manifest in %s", dir)
+		case err != nil:
+			return prev, next, fmt.Errorf("failed to read manifest: %w", err)
+		}
+		if err := json.Unmarshal(data, &prev); err != nil {
+			return prev, next, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if prev.Version != manifestVersion {
+			return prev, next, fmt.Errorf("cannot resume: manifest version %d is not supported", prev.Version)
+		}
+	}
+
+	next = Manifest{
+		Version: manifestVersion,
+		Blocks:  make([]ManifestBlock, len(script.Blocks)),
+	}
+	for i, block := range script.Blocks {
+		mb := ManifestBlock{Key: blockKey(block, format)}
+		if i < len(prev.Blocks) && prev.Blocks[i].Done && prev.Blocks[i].Key == mb.Key {
+			if _, err := os.Stat(filepath.Join(dir, prev.Blocks[i].File)); err == nil {
+				mb = prev.Blocks[i]
+			}
+		}
+		next.Blocks[i] = mb
+	}
+	return prev, next, nil
+}
+
+// Dir returns the work directory path.
+func (w *WorkDir) Dir() string {
+	return w.dir
+}
+
+// Done returns the number of blocks already finished.
+func (w *WorkDir) Done() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := 0
+	for _, b := range w.manifest.Blocks {
+		if b.Done {
+			n++
+		}
+	}
+	return n
+}
+
+// Has reports whether a previous run finished block i.
+func (w *WorkDir) Has(i int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.manifest.Blocks[i].Done
+}
+
+// Load returns the audio of block i if a previous run finished it.
+func (w *WorkDir) Load(i int) ([]byte, bool) {
+	w.mu.Lock()
+	mb := w.manifest.Blocks[i]
+	w.mu.Unlock()
+	if !mb.Done {
+		return nil, false
+	}
+	data, err := os.ReadFile(filepath.Join(w.dir, mb.File))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Save stores the audio of block i and marks it finished in the manifest.
+func (w *WorkDir) Save(i int, pcm []byte) error {
+	name := fmt.Sprintf("block_%04d.pcm", i+1)
+	if err := atomicfile.Write(filepath.Join(w.dir, name), pcm, 0600); err != nil {
+		return fmt.Errorf("failed to save block %d: %w", i, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.manifest.Blocks[i].Done = true
+	w.manifest.Blocks[i].File = name
+	return w.writeManifestLocked()
+}
+
+// Close releases the lock on the work directory and keeps its contents for
+// a later run to resume.
+func (w *WorkDir) Close() error {
+	if w.lock == nil {
+		return nil
+	}
+	err := w.lock.Close()
+	w.lock = nil
+	return err
+}
+
+// Remove releases the lock and deletes the work directory and everything
+// in it.
+func (w *WorkDir) Remove() error {
+	w.Close()
+	return os.RemoveAll(w.dir)
+}
+
+func (w *WorkDir) writeManifest() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.writeManifestLocked()
+}
+
+func (w *WorkDir) writeManifestLocked() error {
+	data, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := atomicfile.Write(filepath.Join(w.dir, manifestName), data, 0600); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// blockKey identifies everything about a block that affects its rendered
+// PCM, including block types that never reach the API. Fields that only
+// position a block on the timeline are left out so layout edits do not
+// invalidate finished blocks.
+func blockKey(block Block, format string) string {
+	if key, ok := cacheKey(block, format); ok {
+		return key
+	}
+	data, _ := json.Marshal(struct {
+		Type     string  `json:"type"`
+		Duration float64 `json:"duration"`
+		Format   string  `json:"format"`
+	}{block.Type, block.Duration, format})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
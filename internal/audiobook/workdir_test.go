@@ -0,0 +1,182 @@
+package audiobook
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testFormat = "pcm_44100"
+
+func testScript(texts ...string) *Script {
+	s := &Script{}
+	for _, text := range texts {
+		s.Blocks = append(s.Blocks, Block{Type: "tts", Voice: "v", Text: text})
+	}
+	return s
+}
+
+func readManifest(t *testing.T, dir string) Manifest {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestWorkDirManifest(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "work")
+	script := testScript("one", "two")
+	w, err := OpenWorkDir(dir, script, testFormat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	m := readManifest(t, dir)
+	if m.Version != manifestVersion || len(m.Blocks) != 2 {
+		t.Fatalf("manifest %+v", m)
+	}
+	for i, b := range m.Blocks {
+		if b.Done || b.Key != blockKey(script.Blocks[i], testFormat) {
+			t.Errorf("block %d: %+v before rendering", i, b)
+		}
+	}
+
+	if err := w.Save(1, []byte{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	m = readManifest(t, dir)
+	if m.Blocks[0].Done || !m.Blocks[1].Done || m.Blocks[1].File == "" {
+		t.Errorf("manifest after saving block 1: %+v", m.Blocks)
+	}
+	if pcm, ok := w.Load(1); !ok || !bytes.Equal(pcm, []byte{1, 2}) {
+		t.Errorf("Load(1) = %v, %v", pcm, ok)
+	}
+	if _, ok := w.Load(0); ok {
+		t.Error("Load(0) found a block that was not saved")
+	}
+	if !w.Has(1) || w.Has(0) || w.Done() != 1 {
+		t.Errorf("Has(0) = %v, Has(1) = %v, Done() = %d", w.Has(0), w.Has(1), w.Done())
+	}
+}
+
+func TestWorkDirResume(t *testing.T) {
+	dir := t.TempDir()
+	w, err := OpenWorkDir(dir, testScript("one", "two", "three"), testFormat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		if err := w.Save(i, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	// The second block changed, so only the others are reused and its old
+	// file is dropped.
+	w, err = OpenWorkDir(dir, testScript("one", "2", "three"), testFormat, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if !w.Has(0) || w.Has(1) || !w.Has(2) {
+		t.Errorf("resumed Has = %v %v %v, want true false true", w.Has(0), w.Has(1), w.Has(2))
+	}
+	if pcm, ok := w.Load(2); !ok || !bytes.Equal(pcm, []byte{2}) {
+		t.Errorf("Load(2) = %v, %v", pcm, ok)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "block_0002.pcm")); !os.IsNotExist(err) {
+		t.Errorf("stale block file: %v", err)
+	}
+}
+
+func TestWorkDirResumeOtherFormat(t *testing.T) {
+	dir := t.TempDir()
+	w, err := OpenWorkDir(dir, testScript("one"), testFormat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Save(0, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	w, err = OpenWorkDir(dir, testScript("one"), "pcm_24000", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if w.Has(0) {
+		t.Error("block rendered in another format was reused")
+	}
+}
+
+func TestWorkDirResumeErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := OpenWorkDir(dir, testScript("one"), testFormat, true); err == nil || !strings.Contains(err.Error(), "nothing to resume") {
+		t.Errorf("resume without a manifest: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, manifestName), []byte(`{"version": 99}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenWorkDir(dir, testScript("one"), testFormat, true); err == nil || !strings.Contains(err.Error(), "version 99") {
+		t.Errorf("resume with an unknown manifest version: %v", err)
+	}
+}
+
+func TestWorkDirLock(t *testing.T) {
+	dir := t.TempDir()
+	w, err := OpenWorkDir(dir, testScript("one"), testFormat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newSpool(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second run must neither use the directory nor sweep the spool of
+	// the first.
+	if _, err := OpenWorkDir(dir, testScript("one"), testFormat, false); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("second open: %v", err)
+	}
+	if _, err := os.Stat(s.dir); err != nil {
+		t.Errorf("spool of the running render: %v", err)
+	}
+
+	// Once the first run is gone, its spool is stale.
+	w.Close()
+	w, err = OpenWorkDir(dir, testScript("one"), testFormat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := os.Stat(s.dir); !os.IsNotExist(err) {
+		t.Errorf("stale spool: %v", err)
+	}
+}
+
+func TestWorkDirRemove(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "work")
+	w, err := OpenWorkDir(dir, testScript("one"), testFormat, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("work directory after Remove: %v", err)
+	}
+}
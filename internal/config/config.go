@@ -2,17 +2,22 @@ package config
 
 import (
 	"fmt"
+	"net/url"
+	"time"
 
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
-// Init sets up viper to read from ~/.elevencli.yaml and the ELEVENLABS_API_KEY env var.
+// Init sets up viper to read from ~/.elevencli.yaml and the ELEVENLABS_API_KEY
+// and ELEVENLABS_BASE_URL env vars.
 func Init() {
 	viper.SetConfigName(".elevencli")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath("$HOME")
 	viper.SetEnvPrefix("")
 	_ = viper.BindEnv("api_key", "ELEVENLABS_API_KEY")
+	_ = viper.BindEnv("base_url", "ELEVENLABS_BASE_URL")
 	_ = viper.ReadInConfig() // ok if missing
 }
 
@@ -31,3 +36,47 @@ func ResolveAPIKey(flagValue string) (string, error) {
   3. Config file (~/.elevencli.yaml):
        api_key: <key>`)
 }
+
+// ResolveBaseURL returns the API base URL using priority: flag > env > config file.
+// An empty result means the client default (the public ElevenLabs API).
+func ResolveBaseURL(flagValue string) (string, error) {
+	raw := flagValue
+	if raw == "" {
+		raw = viper.GetString("base_url")
+	}
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid base URL %q: must be an absolute http(s) URL", raw)
+	}
+	return raw, nil
+}
+
+// BindFlags ties config keys to their command-line flags so that a flag set on
+// the command line overrides the config file, which overrides the flag default.
+func BindFlags(flags *pflag.FlagSet) {
+	for key, name := range map[string]string{
+		"max_attempts":   "max-attempts",
+		"max_retry_wait": "max-retry-wait",
+	} {
+		if f := flags.Lookup(name); f != nil {
+			_ = viper.BindPFlag(key, f)
+		}
+	}
+}
+
+// ResolveRetry returns the maximum number of attempts per API request and the
+// cap on a single backoff delay, using priority: flag > config file > default.
+func ResolveRetry() (int, time.Duration, error) {
+	attempts := viper.GetInt("max_attempts")
+	if attempts < 1 {
+		return 0, 0, fmt.Errorf("max_attempts must be at least 1, got %d", attempts)
+	}
+	wait := viper.GetDuration("max_retry_wait")
+	if wait <= 0 {
+		return 0, 0, fmt.Errorf("max_retry_wait must be positive, got %s", wait)
+	}
+	return attempts, wait, nil
+}
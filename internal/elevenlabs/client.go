@@ -0,0 +1,208 @@
+package elevenlabs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the public ElevenLabs API endpoint.
+const DefaultBaseURL = "https://api.elevenlabs.io"
+
+// DefaultTimeout bounds a single HTTP request, including reading the body.
+const DefaultTimeout = 120 * time.Second
+
+// Options configures a Client.
+type Options struct {
+	// BaseURL is the API root, e.g. https://api.elevenlabs.io. Defaults to DefaultBaseURL.
+	BaseURL string
+	// APIKey is sent as the xi-api-key header.
+	APIKey string
+	// Timeout bounds each request. Defaults to DefaultTimeout.
+	Timeout time.Duration
+	// UserAgent is sent as the User-Agent header when non-empty.
+	UserAgent string
+	// MaxAttempts is the total number of tries for a request that fails with
+	// 429, 5xx or a transport error. Defaults to DefaultMaxAttempts; 1
+	// disables retries.
+	MaxAttempts int
+	// MaxWait caps a single backoff delay. Defaults to DefaultMaxWait.
+	MaxWait time.Duration
+	// OnRetry, when set, is called before each retry.
+	OnRetry RetryFunc
+}
+
+// Client talks to the ElevenLabs HTTP API.
+type Client struct {
+	baseURL     string
+	apiKey      string
+	userAgent   string
+	maxAttempts int
+	maxWait     time.Duration
+	onRetry     RetryFunc
+	http        *http.Client
+}
+
+// NewClient returns a Client configured from opts.
+func NewClient(opts Options) *Client {
+	baseURL := strings.TrimRight(opts.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	maxWait := opts.MaxWait
+	if maxWait <= 0 {
+		maxWait = DefaultMaxWait
+	}
+	return &Client{
+		baseURL:     baseURL,
+		apiKey:      opts.APIKey,
+		userAgent:   opts.UserAgent,
+		maxAttempts: maxAttempts,
+		maxWait:     maxWait,
+		onRetry:     opts.OnRetry,
+		http:        &http.Client{Timeout: timeout},
+	}
+}
+
+// request describes a single API call.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	// audio marks endpoints that must return a non-empty audio body.
+	audio bool
+}
+
+// do sends req, retrying transient failures, and returns the raw response
+// body. Non-2xx responses are decoded into an *APIError.
+//
+// Cancelling ctx aborts the in-flight request and any pending backoff.
+func (c *Client) do(ctx context.Context, req request) ([]byte, error) {
+	var payload []byte
+	if req.body != nil {
+		data, err := json.Marshal(req.body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		payload = data
+	}
+
+	for attempt := 1; ; attempt++ {
+		data, err := c.send(ctx, req, payload)
+		if err == nil || ctx.Err() != nil || attempt >= c.maxAttempts || !retryable(err, req.method) {
+			return data, err
+		}
+
+		var retryAfter time.Duration
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			retryAfter = apiErr.RetryAfter
+		}
+		wait := backoff(attempt, retryAfter, c.maxWait)
+		if c.onRetry != nil {
+			c.onRetry(attempt, wait, err)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send performs a single HTTP round trip for req.
+func (c *Client) send(ctx context.Context, req request, payload []byte) ([]byte, error) {
+	u := c.baseURL + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if req.body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if req.audio {
+		httpReq.Header.Set("Accept", "audio/*")
+	} else {
+		httpReq.Header.Set("Accept", "application/json")
+	}
+	if c.apiKey != "" {
+		httpReq.Header.Set("xi-api-key", c.apiKey)
+	}
+	if c.userAgent != "" {
+		httpReq.Header.Set("User-Agent", c.userAgent)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newAPIError(resp, data)
+	}
+
+	if req.audio {
+		if err := validateAudio(resp, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// validateAudio rejects successful responses that do not carry audio, which
+// happens when a proxy answers with an HTML or JSON page instead of the API.
+func validateAudio(resp *http.Response, data []byte) error {
+	ct := resp.Header.Get("Content-Type")
+	if ct != "" && !strings.HasPrefix(ct, "audio/") && !strings.HasPrefix(ct, "application/octet-stream") {
+		return fmt.Errorf("unexpected content type %q in audio response", ct)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("empty audio response")
+	}
+	return nil
+}
+
+// getJSON performs a GET request and decodes the JSON response into v.
+func (c *Client) getJSON(ctx context.Context, path string, v any) error {
+	data, err := c.do(ctx, request{method: http.MethodGet, path: path})
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
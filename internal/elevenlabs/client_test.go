@@ -0,0 +1,176 @@
+package elevenlabs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServer answers each request with the status returned by status for
+// that attempt (1-based), and with audio on 200.
+func testServer(t *testing.T, status func(attempt int, w http.ResponseWriter) int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := status(int(calls.Add(1)), w)
+		if code == http.StatusOK {
+			w.Header().Set("Content-Type", "audio/mpeg")
+			w.Write([]byte("audio"))
+			return
+		}
+		w.WriteHeader(code)
+		w.Write([]byte(`{"detail": {"status": "test", "message": "failure"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// retries records the waits passed to OnRetry.
+type retries struct {
+	waits []time.Duration
+}
+
+func (r *retries) record(_ int, wait time.Duration, _ error) {
+	r.waits = append(r.waits, wait)
+}
+
+func speak(c *Client, ctx context.Context) ([]byte, error) {
+	return c.TextToSpeech(ctx, "voice", TextToSpeechRequest{Text: "hi"}, "mp3_44100_128")
+}
+
+func TestRetryAfter(t *testing.T) {
+	srv, calls := testServer(t, func(attempt int, w http.ResponseWriter) int {
+		if attempt == 1 {
+			w.Header().Set("Retry-After", "1")
+			return http.StatusTooManyRequests
+		}
+		return http.StatusOK
+	})
+	var r retries
+	c := NewClient(Options{BaseURL: srv.URL, OnRetry: r.record})
+	start := time.Now()
+	data, err := speak(c, context.Background())
+	if err != nil || string(data) != "audio" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	if calls.Load() != 2 || len(r.waits) != 1 || r.waits[0] != time.Second {
+		t.Errorf("%d calls, waits %v; want 2 calls after waiting 1s", calls.Load(), r.waits)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, before Retry-After", elapsed)
+	}
+}
+
+func TestRetryAfterCapped(t *testing.T) {
+	srv, calls := testServer(t, func(attempt int, w http.ResponseWriter) int {
+		if attempt == 1 {
+			w.Header().Set("Retry-After", "30")
+			return http.StatusTooManyRequests
+		}
+		return http.StatusOK
+	})
+	var r retries
+	c := NewClient(Options{BaseURL: srv.URL, MaxWait: 10 * time.Millisecond, OnRetry: r.record})
+	if _, err := speak(c, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 2 || len(r.waits) != 1 || r.waits[0] != 10*time.Millisecond {
+		t.Errorf("%d calls, waits %v; want 2 calls after waiting 10ms", calls.Load(), r.waits)
+	}
+}
+
+func TestRetryServerErrors(t *testing.T) {
+	srv, calls := testServer(t, func(attempt int, _ http.ResponseWriter) int {
+		return []int{http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusOK}[attempt-1]
+	})
+	c := NewClient(Options{BaseURL: srv.URL, MaxWait: time.Millisecond})
+	if _, err := speak(c, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("%d calls, want 3", calls.Load())
+	}
+}
+
+func TestRetryAttemptLimit(t *testing.T) {
+	srv, calls := testServer(t, func(int, http.ResponseWriter) int {
+		return http.StatusBadGateway
+	})
+	var r retries
+	c := NewClient(Options{BaseURL: srv.URL, MaxAttempts: 3, MaxWait: time.Millisecond, OnRetry: r.record})
+	_, err := speak(c, context.Background())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("got %v, want the 502 API error", err)
+	}
+	if calls.Load() != 3 || len(r.waits) != 2 {
+		t.Errorf("%d calls and %d retries, want 3 and 2", calls.Load(), len(r.waits))
+	}
+}
+
+func TestNoRetryClientError(t *testing.T) {
+	srv, calls := testServer(t, func(int, http.ResponseWriter) int {
+		return http.StatusBadRequest
+	})
+	c := NewClient(Options{BaseURL: srv.URL, MaxWait: time.Millisecond})
+	if _, err := speak(c, context.Background()); err == nil {
+		t.Fatal("no error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d calls, want 1", calls.Load())
+	}
+}
+
+func TestRetryDroppedConnection(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer srv.Close()
+	c := NewClient(Options{BaseURL: srv.URL, MaxAttempts: 3, MaxWait: time.Millisecond})
+
+	// The POST reached the server and may have been billed: no retry.
+	if _, err := speak(c, context.Background()); err == nil {
+		t.Fatal("POST: no error")
+	}
+	if n := calls.Swap(0); n != 1 {
+		t.Errorf("POST: %d calls, want 1", n)
+	}
+	// A GET is safe to repeat.
+	if _, err := c.GetVoices(context.Background()); err == nil {
+		t.Fatal("GET: no error")
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("GET: %d calls, want 3", n)
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	srv, calls := testServer(t, func(_ int, w http.ResponseWriter) int {
+		w.Header().Set("Retry-After", "30")
+		return http.StatusTooManyRequests
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewClient(Options{BaseURL: srv.URL, OnRetry: func(int, time.Duration, error) {
+		time.AfterFunc(10*time.Millisecond, cancel)
+	}})
+	start := time.Now()
+	_, err := speak(c, ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v, not when cancelled", elapsed)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d calls, want 1", calls.Load())
+	}
+}
@@ -0,0 +1,140 @@
+package elevenlabs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// VoiceSettings overrides the stored settings of a voice for one request.
+// Nil fields are omitted so the API applies its own value; pointers let an
+// explicit 0 be told apart from "unset".
+type VoiceSettings struct {
+	Stability       *float64 `json:"stability,omitempty"`
+	SimilarityBoost *float64 `json:"similarity_boost,omitempty"`
+	Style           *float64 `json:"style,omitempty"`
+	UseSpeakerBoost *bool    `json:"use_speaker_boost,omitempty"`
+	Speed           *float64 `json:"speed,omitempty"`
+}
+
+// IsZero reports whether no setting is overridden.
+func (s VoiceSettings) IsZero() bool {
+	return s.Stability == nil && s.SimilarityBoost == nil && s.Style == nil &&
+		s.UseSpeakerBoost == nil && s.Speed == nil
+}
+
+// Validate checks that every set value is within the range the API accepts.
+func (s VoiceSettings) Validate() error {
+	for _, r := range []struct {
+		name     string
+		v        *float64
+		min, max float64
+	}{
+		{"stability", s.Stability, 0, 1},
+		{"similarity_boost", s.SimilarityBoost, 0, 1},
+		{"style", s.Style, 0, 1},
+		{"speed", s.Speed, 0.7, 1.2},
+	} {
+		if r.v != nil && (*r.v < r.min || *r.v > r.max) {
+			return fmt.Errorf("'%s' must be between %.1f and %.1f", r.name, r.min, r.max)
+		}
+	}
+	return nil
+}
+
+// TextToSpeechRequest is the body of a text-to-speech call.
+type TextToSpeechRequest struct {
+	Text          string         `json:"text"`
+	ModelID       string         `json:"model_id,omitempty"`
+	VoiceSettings *VoiceSettings `json:"voice_settings,omitempty"`
+}
+
+// TextToSpeech synthesizes req.Text with the given voice and returns audio
+// encoded in outputFormat (e.g. "mp3_44100_128", "pcm_44100").
+func (c *Client) TextToSpeech(ctx context.Context, voiceID string, req TextToSpeechRequest, outputFormat string) ([]byte, error) {
+	return c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/v1/text-to-speech/" + url.PathEscape(voiceID),
+		query:  url.Values{"output_format": {outputFormat}},
+		body:   req,
+		audio:  true,
+	})
+}
+
+// SoundGenerationRequest is the body of a sound-generation call.
+type SoundGenerationRequest struct {
+	Text            string  `json:"text"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+}
+
+// SoundGeneration renders a sound effect from a text prompt and returns
+// audio encoded in outputFormat.
+func (c *Client) SoundGeneration(ctx context.Context, req SoundGenerationRequest, outputFormat string) ([]byte, error) {
+	return c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/v1/sound-generation",
+		query:  url.Values{"output_format": {outputFormat}},
+		body:   req,
+		audio:  true,
+	})
+}
+
+// Voice is a voice available to the account.
+type Voice struct {
+	VoiceID  string            `json:"voice_id"`
+	Name     string            `json:"name"`
+	Category string            `json:"category"`
+	Labels   map[string]string `json:"labels"`
+}
+
+// GetVoices lists the voices available to the account.
+func (c *Client) GetVoices(ctx context.Context) ([]Voice, error) {
+	var resp struct {
+		Voices []Voice `json:"voices"`
+	}
+	if err := c.getJSON(ctx, "/v1/voices", &resp); err != nil {
+		return nil, err
+	}
+	return resp.Voices, nil
+}
+
+// Subscription describes the account's plan and character quota.
+type Subscription struct {
+	Tier                        string `json:"tier"`
+	Status                      string `json:"status"`
+	CharacterCount              int    `json:"character_count"`
+	CharacterLimit              int    `json:"character_limit"`
+	CanExtendCharacterLimit     bool   `json:"can_extend_character_limit"`
+	NextCharacterCountResetUnix int64  `json:"next_character_count_reset_unix"`
+	VoiceSlotsUsed              int    `json:"voice_slots_used"`
+	VoiceLimit                  int    `json:"voice_limit"`
+	ProfessionalVoiceLimit      int    `json:"professional_voice_limit"`
+}
+
+// CharactersRemaining returns the quota left in the current period.
+func (s *Subscription) CharactersRemaining() int {
+	if s.CharacterCount >= s.CharacterLimit {
+		return 0
+	}
+	return s.CharacterLimit - s.CharacterCount
+}
+
+// NextReset returns when the character count resets, or the zero time if
+// the API did not report it.
+func (s *Subscription) NextReset() time.Time {
+	if s.NextCharacterCountResetUnix == 0 {
+		return time.Time{}
+	}
+	return time.Unix(s.NextCharacterCountResetUnix, 0)
+}
+
+// GetSubscription returns the account's subscription and quota usage.
+func (c *Client) GetSubscription(ctx context.Context) (*Subscription, error) {
+	var sub Subscription
+	if err := c.getJSON(ctx, "/v1/user/subscription", &sub); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
@@ -0,0 +1,94 @@
+package elevenlabs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIError is returned for non-2xx responses from the API.
+type APIError struct {
+	StatusCode int
+	// Status is the machine-readable status from the error body, if any
+	// (e.g. "quota_exceeded", "voice_not_found").
+	Status  string
+	Message string
+	// RetryAfter is the delay requested by the server's Retry-After header,
+	// or 0 if none was sent.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.Status != "" {
+		return fmt.Sprintf("API error (%d %s): %s", e.StatusCode, e.Status, msg)
+	}
+	return fmt.Sprintf("API error (%d): %s", e.StatusCode, msg)
+}
+
+// newAPIError decodes the error body. ElevenLabs returns one of:
+//
+//	{"detail": {"status": "...", "message": "..."}}
+//	{"detail": "message"}
+//	{"detail": [{"loc": [...], "msg": "...", "type": "..."}]}  (validation errors)
+//
+// Anything else is reported verbatim.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	var envelope struct {
+		Detail json.RawMessage `json:"detail"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil || len(envelope.Detail) == 0 {
+		apiErr.Message = strings.TrimSpace(string(body))
+		return apiErr
+	}
+
+	var obj struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(envelope.Detail, &obj); err == nil && obj.Message != "" {
+		apiErr.Status = obj.Status
+		apiErr.Message = obj.Message
+		return apiErr
+	}
+
+	var str string
+	if err := json.Unmarshal(envelope.Detail, &str); err == nil {
+		apiErr.Message = str
+		return apiErr
+	}
+
+	var list []struct {
+		Loc []any  `json:"loc"`
+		Msg string `json:"msg"`
+	}
+	if err := json.Unmarshal(envelope.Detail, &list); err == nil && len(list) > 0 {
+		msgs := make([]string, 0, len(list))
+		for _, item := range list {
+			loc := make([]string, 0, len(item.Loc))
+			for _, l := range item.Loc {
+				loc = append(loc, fmt.Sprint(l))
+			}
+			if len(loc) > 0 {
+				msgs = append(msgs, strings.Join(loc, ".")+": "+item.Msg)
+			} else {
+				msgs = append(msgs, item.Msg)
+			}
+		}
+		apiErr.Message = strings.Join(msgs, "; ")
+		return apiErr
+	}
+
+	apiErr.Message = strings.TrimSpace(string(body))
+	return apiErr
+}
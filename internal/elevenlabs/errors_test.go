@@ -0,0 +1,42 @@
+package elevenlabs
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewAPIError(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		body   string
+		status string
+		msg    string
+	}{
+		{"object", `{"detail": {"status": "quota_exceeded", "message": "Out of credits"}}`, "quota_exceeded", "Out of credits"},
+		{"string", `{"detail": "Voice not found"}`, "", "Voice not found"},
+		{"validation", `{"detail": [{"loc": ["body", "text"], "msg": "field required"}, {"msg": "bad"}]}`, "", "body.text: field required; bad"},
+		{"other JSON", `{"error": "nope"}`, "", `{"error": "nope"}`},
+		{"plain text", "  Bad Gateway\n", "", "Bad Gateway"},
+		{"empty", "", "", ""},
+	} {
+		resp := &http.Response{StatusCode: 422, Header: http.Header{}}
+		err := newAPIError(resp, []byte(tt.body))
+		if err.StatusCode != 422 || err.Status != tt.status || err.Message != tt.msg {
+			t.Errorf("%s: got %d %q %q, want 422 %q %q", tt.name, err.StatusCode, err.Status, err.Message, tt.status, tt.msg)
+		}
+	}
+
+	resp := &http.Response{StatusCode: 429, Header: http.Header{"Retry-After": {"3"}}}
+	err := newAPIError(resp, nil)
+	if err.RetryAfter != 3*time.Second {
+		t.Errorf("RetryAfter = %v, want 3s", err.RetryAfter)
+	}
+	if got, want := err.Error(), "API error (429): Too Many Requests"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	err.Status, err.Message = "rate_limited", "slow down"
+	if got, want := err.Error(), "API error (429 rate_limited): slow down"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package elevenlabs
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is the total number of tries for a request,
+	// including the first one.
+	DefaultMaxAttempts = 5
+	// DefaultMaxWait caps a single backoff delay, including delays requested
+	// by a Retry-After header.
+	DefaultMaxWait = 60 * time.Second
+
+	baseBackoff = 1 * time.Second
+)
+
+// RetryFunc is called before each retry with the attempt that failed
+// (1-based), the delay before the next attempt and the error that caused it.
+type RetryFunc func(attempt int, wait time.Duration, err error)
+
+// retryable reports whether a request with the given method that failed
+// with err is worth another attempt: rate limiting, server-side failures and
+// transport errors that are safe to repeat. Any transport error is safe for
+// a GET, but a POST that failed after it was sent may already have been
+// processed and billed, so it is only retried if it never reached the
+// server.
+func retryable(err error, method string) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+	if method == http.MethodGet || method == http.MethodHead {
+		return true
+	}
+	return unsent(err)
+}
+
+// unsent reports whether a transport error happened before the request
+// could be sent: while resolving the host or connecting to it.
+func unsent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// backoff returns the delay before retry number attempt (1-based). It honors
+// the server's Retry-After when present, otherwise uses exponential backoff
+// with jitter in [d/2, d]. The result never exceeds maxWait.
+func backoff(attempt int, retryAfter time.Duration, maxWait time.Duration) time.Duration {
+	var d time.Duration
+	if retryAfter > 0 {
+		d = retryAfter
+	} else {
+		d = baseBackoff << (attempt - 1)
+		if d <= 0 || d > maxWait {
+			d = maxWait
+		}
+		d = d/2 + rand.N(d/2+1)
+	}
+	if d > maxWait {
+		d = maxWait
+	}
+	return d
+}
+
+// parseRetryAfter reads a Retry-After header given either as delay seconds
+// or as an HTTP date. It returns 0 when the header is absent or invalid.
+func parseRetryAfter(h string) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(h); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
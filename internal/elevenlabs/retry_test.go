@@ -0,0 +1,106 @@
+package elevenlabs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	// Without Retry-After the delay doubles from baseBackoff, with jitter
+	// down to half of it.
+	for attempt := 1; attempt <= 5; attempt++ {
+		d := baseBackoff << (attempt - 1)
+		for range 100 {
+			if got := backoff(attempt, 0, time.Hour); got < d/2 || got > d {
+				t.Fatalf("attempt %d: backoff %v outside [%v, %v]", attempt, got, d/2, d)
+			}
+		}
+	}
+	// Retry-After is used as is, without jitter.
+	if got := backoff(1, 7*time.Second, time.Minute); got != 7*time.Second {
+		t.Errorf("Retry-After 7s: backoff %v", got)
+	}
+	// maxWait caps both, and shifts that overflow.
+	for _, tt := range []struct {
+		attempt    int
+		retryAfter time.Duration
+	}{
+		{1, time.Hour},
+		{10, 0},
+		{100, 0},
+	} {
+		if got := backoff(tt.attempt, tt.retryAfter, 3*time.Second); got > 3*time.Second || got < 1500*time.Millisecond {
+			t.Errorf("attempt %d, Retry-After %v: backoff %v, want at most 3s", tt.attempt, tt.retryAfter, got)
+		}
+	}
+	if got := backoff(1, 0, time.Nanosecond); got > time.Nanosecond {
+		t.Errorf("maxWait 1ns: backoff %v", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, tt := range []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"5", 5 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	} {
+		if got := parseRetryAfter(tt.header); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+	// An HTTP date in the future is a delay until then; the header only
+	// has whole seconds.
+	date := time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got < 88*time.Second || got > 90*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %v, want about 90s", date, got)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	transport := func(err error) error {
+		return &url.Error{Op: "Post", URL: "http://x", Err: err}
+	}
+	dial := transport(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")})
+	dns := transport(&net.DNSError{Err: "no such host", Name: "x"})
+	read := transport(&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")})
+	eof := transport(errors.New("EOF"))
+
+	for _, tt := range []struct {
+		name   string
+		err    error
+		method string
+		want   bool
+	}{
+		{"429", &APIError{StatusCode: 429}, http.MethodPost, true},
+		{"500", &APIError{StatusCode: 500}, http.MethodPost, true},
+		{"502", &APIError{StatusCode: 502}, http.MethodPost, true},
+		{"503", &APIError{StatusCode: 503}, http.MethodPost, true},
+		{"504", &APIError{StatusCode: 504}, http.MethodPost, true},
+		{"400", &APIError{StatusCode: 400}, http.MethodPost, false},
+		{"401", &APIError{StatusCode: 401}, http.MethodGet, false},
+		{"501", &APIError{StatusCode: 501}, http.MethodGet, false},
+		{"dial POST", dial, http.MethodPost, true},
+		{"DNS POST", dns, http.MethodPost, true},
+		{"read POST", read, http.MethodPost, false},
+		{"EOF POST", eof, http.MethodPost, false},
+		{"read GET", read, http.MethodGet, true},
+		{"EOF HEAD", eof, http.MethodHead, true},
+		{"other", errors.New("bad audio"), http.MethodGet, false},
+		{"cancelled", context.Canceled, http.MethodGet, false},
+	} {
+		if got := retryable(tt.err, tt.method); got != tt.want {
+			t.Errorf("%s: retryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
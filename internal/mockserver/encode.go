@@ -0,0 +1,89 @@
+package mockserver
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/deegital/elevencli/internal/audio"
+)
+
+// outputFormat is a parsed ElevenLabs output_format value such as
+// "mp3_44100_128", "pcm_22050" or "ulaw_8000".
+type outputFormat struct {
+	codec string
+	rate  int
+	// bitrate is the MP3 bitrate in kbps.
+	bitrate int
+}
+
+var supportedRates = map[string][]int{
+	"mp3":  {22050, 44100},
+	"pcm":  {8000, 16000, 22050, 24000, 44100, 48000},
+	"ulaw": {8000},
+	"alaw": {8000},
+}
+
+func parseOutputFormat(s string) (outputFormat, error) {
+	if s == "" {
+		s = "mp3_44100_128"
+	}
+	parts := strings.Split(s, "_")
+	if len(parts) < 2 {
+		return outputFormat{}, fmt.Errorf("invalid output format %q", s)
+	}
+	rates, ok := supportedRates[parts[0]]
+	if !ok {
+		return outputFormat{}, fmt.Errorf("unsupported output format %q", s)
+	}
+	rate, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return outputFormat{}, fmt.Errorf("invalid output format %q", s)
+	}
+	if !slices.Contains(rates, rate) {
+		return outputFormat{}, fmt.Errorf("unsupported sample rate in output format %q", s)
+	}
+	f := outputFormat{codec: parts[0], rate: rate}
+	if f.codec == "mp3" {
+		f.bitrate = audio.DefaultMP3Bitrate
+		if len(parts) > 2 {
+			if f.bitrate, err = strconv.Atoi(parts[2]); err != nil {
+				return outputFormat{}, fmt.Errorf("invalid output format %q", s)
+			}
+		}
+		if err := audio.CheckMP3(rate, 1, f.bitrate, audio.MP3Auto); err != nil {
+			return outputFormat{}, fmt.Errorf("unsupported output format %q: %v", s, err)
+		}
+	}
+	return f, nil
+}
+
+func (f outputFormat) contentType() string {
+	switch f.codec {
+	case "mp3":
+		return "audio/mpeg"
+	case "ulaw", "alaw":
+		return "audio/basic"
+	}
+	return "audio/pcm"
+}
+
+// encode converts float samples in [-1, 1] to the wire format.
+func (f outputFormat) encode(samples []float64) ([]byte, error) {
+	buf := audio.NewBuffer(f.rate, 1, len(samples))
+	for i, s := range samples {
+		buf.Samples[i] = float32(s)
+	}
+	switch f.codec {
+	case "pcm":
+		return buf.Encode(audio.PCM16), nil
+	case "mp3":
+		return audio.EncodeMP3(buf.PCM16(), f.rate, audio.Channels, f.bitrate, audio.MP3Auto)
+	case "ulaw":
+		return buf.Encode(audio.MuLaw), nil
+	case "alaw":
+		return buf.Encode(audio.ALaw), nil
+	}
+	return nil, fmt.Errorf("unsupported codec %q", f.codec)
+}
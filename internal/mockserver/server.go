@@ -0,0 +1,231 @@
+// Package mockserver implements a local stand-in for the ElevenLabs API.
+//
+// It serves the text-to-speech, sound-generation, voices and subscription
+// endpoints used by elevencli and answers with deterministic synthesized audio of plausible
+// length, so the CLI can run offline and without spending credits.
+package mockserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Voice is an entry in the mock voice list.
+type Voice struct {
+	VoiceID  string            `json:"voice_id"`
+	Name     string            `json:"name"`
+	Category string            `json:"category"`
+	Labels   map[string]string `json:"labels"`
+}
+
+// DefaultVoices mirrors a few of the public premade voices so example
+// scripts work unchanged. Any other voice ID is accepted as well.
+var DefaultVoices = []Voice{
+	{VoiceID: "JBFqnCBsd6RMkjVDRZzb", Name: "George", Category: "premade",
+		Labels: map[string]string{"accent": "british", "gender": "male", "age": "middle aged"}},
+	{VoiceID: "pNInz6obpgDQGcFmaJgB", Name: "Adam", Category: "premade",
+		Labels: map[string]string{"accent": "american", "gender": "male", "age": "middle aged"}},
+	{VoiceID: "EXAVITQu4vr4xnSDxMaL", Name: "Sarah", Category: "premade",
+		Labels: map[string]string{"accent": "american", "gender": "female", "age": "young"}},
+	{VoiceID: "XB0fDUnXU5powFXDhCwa", Name: "Charlotte", Category: "premade",
+		Labels: map[string]string{"accent": "swedish", "gender": "female", "age": "young"}},
+}
+
+// Options configures a Server.
+type Options struct {
+	// Voices is the list returned by GET /v1/voices. Defaults to DefaultVoices.
+	Voices []Voice
+	// Latency delays every audio response, to exercise timeouts and
+	// concurrency against something slower than localhost.
+	Latency time.Duration
+	// CharacterLimit is the quota reported by GET /v1/user/subscription.
+	// Defaults to DefaultCharacterLimit.
+	CharacterLimit int
+	// Logf, when set, receives one line per request.
+	Logf func(format string, args ...any)
+}
+
+// DefaultCharacterLimit is the mock account's monthly character quota.
+const DefaultCharacterLimit = 100000
+
+// Server is an http.Handler implementing a subset of the ElevenLabs API.
+type Server struct {
+	opts  Options
+	mux   *http.ServeMux
+	start time.Time
+
+	mu sync.Mutex
+	// charsUsed counts characters billed since the server started.
+	charsUsed int
+}
+
+// New returns a Server configured from opts.
+func New(opts Options) *Server {
+	if opts.Voices == nil {
+		opts.Voices = DefaultVoices
+	}
+	if opts.CharacterLimit == 0 {
+		opts.CharacterLimit = DefaultCharacterLimit
+	}
+	s := &Server{opts: opts, mux: http.NewServeMux(), start: time.Now()}
+	s.mux.HandleFunc("POST /v1/text-to-speech/{voice_id}", s.handleTTS)
+	s.mux.HandleFunc("POST /v1/sound-generation", s.handleSFX)
+	s.mux.HandleFunc("GET /v1/voices", s.handleVoices)
+	s.mux.HandleFunc("GET /v1/user/subscription", s.handleSubscription)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("xi-api-key") == "" {
+		writeError(w, http.StatusUnauthorized, "missing_api_key", "Missing xi-api-key header.")
+		return
+	}
+	if s.opts.Logf != nil {
+		s.opts.Logf("%s %s", r.Method, r.URL.RequestURI())
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+type ttsRequest struct {
+	Text          string `json:"text"`
+	ModelID       string `json:"model_id"`
+	VoiceSettings *struct {
+		Speed *float64 `json:"speed"`
+	} `json:"voice_settings"`
+}
+
+func (s *Server) handleTTS(w http.ResponseWriter, r *http.Request) {
+	var req ttsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeValidationError(w, "body", "", "invalid JSON: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		writeValidationError(w, "body", "text", "field required")
+		return
+	}
+	format, err := parseOutputFormat(r.URL.Query().Get("output_format"))
+	if err != nil {
+		writeValidationError(w, "query", "output_format", err.Error())
+		return
+	}
+	speed := 1.0
+	if req.VoiceSettings != nil && req.VoiceSettings.Speed != nil {
+		speed = *req.VoiceSettings.Speed
+	}
+
+	samples := synthSpeech(r.PathValue("voice_id"), req.Text, speed, format.rate)
+	s.writeAudio(w, r, format, samples, len([]rune(req.Text)))
+}
+
+type sfxRequest struct {
+	Text            string  `json:"text"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+func (s *Server) handleSFX(w http.ResponseWriter, r *http.Request) {
+	var req sfxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeValidationError(w, "body", "", "invalid JSON: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		writeValidationError(w, "body", "text", "field required")
+		return
+	}
+	if req.DurationSeconds != 0 && (req.DurationSeconds < 0.5 || req.DurationSeconds > 30) {
+		writeValidationError(w, "body", "duration_seconds", "must be between 0.5 and 30")
+		return
+	}
+	format, err := parseOutputFormat(r.URL.Query().Get("output_format"))
+	if err != nil {
+		writeValidationError(w, "query", "output_format", err.Error())
+		return
+	}
+
+	duration := sfxDuration(req.Text, req.DurationSeconds)
+	samples := synthSFX(req.Text, duration, format.rate)
+	s.writeAudio(w, r, format, samples, len([]rune(req.Text)))
+}
+
+func (s *Server) handleVoices(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"voices": s.opts.Voices})
+}
+
+func (s *Server) handleSubscription(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	used := s.charsUsed
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"tier":                            "mock",
+		"status":                          "active",
+		"character_count":                 used,
+		"character_limit":                 s.opts.CharacterLimit,
+		"can_extend_character_limit":      false,
+		"next_character_count_reset_unix": s.start.AddDate(0, 1, 0).Unix(),
+		"voice_slots_used":                0,
+		"voice_limit":                     len(s.opts.Voices),
+		"professional_voice_limit":        0,
+	})
+}
+
+func (s *Server) writeAudio(w http.ResponseWriter, r *http.Request, format outputFormat, samples []float64, chars int) {
+	data, err := format.encode(samples)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "encoding_failed", err.Error())
+		return
+	}
+
+	if s.opts.Latency > 0 {
+		select {
+		case <-time.After(s.opts.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.charsUsed += chars
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", format.contentType())
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("character-cost", strconv.Itoa(chars))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers in the {"detail": {"status", "message"}} shape used by
+// the real API.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]any{
+		"detail": map[string]string{"status": code, "message": message},
+	})
+}
+
+// writeValidationError answers with a 422 in the FastAPI validation shape.
+func writeValidationError(w http.ResponseWriter, in, field, msg string) {
+	loc := []string{in}
+	if field != "" {
+		loc = append(loc, field)
+	}
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+		"detail": []map[string]any{{
+			"loc":  loc,
+			"msg":  msg,
+			"type": "value_error",
+		}},
+	})
+}
@@ -0,0 +1,122 @@
+package mockserver
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	// charsPerSecond approximates natural narration pace (~150 wpm).
+	charsPerSecond = 15.0
+	// edgePadding mimics the short silence the real API leaves at the start
+	// and end of generated speech.
+	edgePadding = 0.1
+)
+
+// seed derives a stable 64-bit seed from the given strings.
+func seed(parts ...string) uint64 {
+	h := fnv.New64a()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// speechDuration returns how long synthesized speech for text lasts.
+func speechDuration(text string, speed float64) float64 {
+	if speed <= 0 {
+		speed = 1
+	}
+	d := float64(len([]rune(text)))/charsPerSecond/speed + 2*edgePadding
+	return math.Max(d, 0.5)
+}
+
+// synthSpeech renders a speech-like signal for text: one voiced burst per
+// word with a pitch derived from the voice ID, short gaps between words and
+// longer pauses after sentence punctuation. The output is deterministic for
+// a given voice, text, speed and sample rate.
+func synthSpeech(voiceID, text string, speed float64, rate int) []float64 {
+	if speed <= 0 {
+		speed = 1
+	}
+	total := int(speechDuration(text, speed) * float64(rate))
+	out := make([]float64, total)
+
+	s := seed(voiceID)
+	f0 := 90 + float64(s%140) // fundamental between 90 and 230 Hz
+	charLen := 1 / charsPerSecond / speed
+
+	pos := int(edgePadding * float64(rate))
+	words := strings.Fields(text)
+	for wi, word := range words {
+		n := int(float64(len([]rune(word))) * charLen * float64(rate))
+		// Vary pitch slightly per word so consecutive words differ.
+		ws := seed(voiceID, word)
+		pitch := f0 * (0.9 + 0.2*float64(ws%1000)/1000)
+		for i := 0; i < n && pos+i < total; i++ {
+			t := float64(i) / float64(rate)
+			env := math.Sin(math.Pi * float64(i) / float64(n)) // word-level envelope
+			sample := 0.6*math.Sin(2*math.Pi*pitch*t) +
+				0.25*math.Sin(2*math.Pi*2*pitch*t) +
+				0.15*math.Sin(2*math.Pi*3*pitch*t)
+			out[pos+i] = 0.35 * env * sample
+		}
+		pos += n
+
+		// Gap between words; sentence punctuation adds a longer pause.
+		gap := charLen
+		if last := []rune(word)[len([]rune(word))-1]; wi < len(words)-1 && unicode.IsPunct(last) {
+			switch last {
+			case '.', '!', '?':
+				gap += 0.3 / speed
+			case ',', ';', ':':
+				gap += 0.12 / speed
+			}
+		}
+		pos += int(gap * float64(rate))
+	}
+	return out
+}
+
+// sfxDuration returns the length of a generated sound effect: the requested
+// duration, or a prompt-dependent length between 1.5 and 5 seconds.
+func sfxDuration(prompt string, requested float64) float64 {
+	if requested > 0 {
+		return requested
+	}
+	return 1.5 + float64(seed(prompt)%350)/100
+}
+
+// synthSFX renders filtered noise with a slow amplitude swell whose
+// character (brightness, modulation rate) is derived from the prompt.
+func synthSFX(prompt string, duration float64, rate int) []float64 {
+	n := int(duration * float64(rate))
+	out := make([]float64, n)
+
+	s := seed(prompt)
+	state := s | 1
+	// One-pole low-pass cutoff between 300 Hz and 6 kHz.
+	cutoff := 300 + float64(s%5700)
+	alpha := 1 - math.Exp(-2*math.Pi*cutoff/float64(rate))
+	lfo := 0.1 + float64((s>>16)%100)/100 // 0.1–1.1 Hz swell
+
+	var y float64
+	for i := range out {
+		// xorshift64* PRNG
+		state ^= state >> 12
+		state ^= state << 25
+		state ^= state >> 27
+		r := float64(state*2685821657736338717>>11)/float64(1<<53)*2 - 1
+
+		y += alpha * (r - y)
+		t := float64(i) / float64(rate)
+		env := 0.6 + 0.4*math.Sin(2*math.Pi*lfo*t)
+		// Short fades so the effect does not click at its edges.
+		edge := math.Min(1, math.Min(t, duration-t)/0.02)
+		out[i] = 0.5 * env * edge * y / math.Sqrt(alpha)
+	}
+	return out
+}